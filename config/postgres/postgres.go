@@ -87,6 +87,17 @@ func ConnectGORM() (*gorm.DB, error) {
 // DropAllTables drops all tables in the database
 func DropAllTables(db *gorm.DB) error {
 	tables := []interface{}{
+		&postgres.UserBlock{},
+		&postgres.UserFollow{},
+		&postgres.UserPrivacySettings{},
+		&postgres.SystemEvent{},
+		&postgres.DataExport{},
+		&postgres.Notification{},
+		&postgres.PersonalAccessToken{},
+		&postgres.ExternalIdentity{},
+		&postgres.RecoveryCode{},
+		&postgres.SpentRefreshToken{},
+		&postgres.UserSession{},
 		&postgres.User{},
 	}
 
@@ -112,6 +123,17 @@ func MigrateDatabase(db *gorm.DB) error {
 	// NOTE: for more info, execute db.Debug().AutoMigrate(...)
 	err := db.AutoMigrate(
 		postgres.User{},
+		postgres.UserSession{},
+		postgres.SpentRefreshToken{},
+		postgres.RecoveryCode{},
+		postgres.ExternalIdentity{},
+		postgres.PersonalAccessToken{},
+		postgres.Notification{},
+		postgres.DataExport{},
+		postgres.SystemEvent{},
+		postgres.UserPrivacySettings{},
+		postgres.UserFollow{},
+		postgres.UserBlock{},
 	)
 
 	if err != nil {
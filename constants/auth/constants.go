@@ -1,5 +1,133 @@
 package auth
 
+import "time"
+
+// Claves de los claims del JWT
+const (
+	Email     = "Email"
+	SessionID = "sid"
+	TokenType = "typ"
+	// Actor identifica al administrador que suplanta al usuario (claim "act" de RFC 8693)
+	Actor = "act"
+)
+
+// Claves usadas para guardar datos de la autenticación en el gin.Context
+const (
+	ContextEmail     = "auth_email"
+	ContextSessionID = "auth_session_id"
+	ContextUser      = "auth_user"
+	// Solo existen cuando la petición se autenticó con un token de acceso personal
+	ContextTokenID     = "auth_token_id"
+	ContextTokenScopes = "auth_token_scopes"
+	// Solo existe cuando un administrador está suplantando al usuario
+	ContextImpersonator = "auth_impersonator"
+	// Ámbito con el que la ruta admite tokens de acceso personal (ver middleware.AllowPersonalTokens)
+	ContextAllowedScope = "auth_allowed_scope"
+)
+
+// Tipos de token emitidos por el backend
+const (
+	TokenTypeAccess             = "access"
+	TokenTypeTwoFactorChallenge = "2fa_challenge"
+	TokenTypeOIDCLink           = "oidc_link"
+)
+
+// TwoFactorChallengeTTL es el tiempo que tiene el usuario para introducir el código TOTP tras la contraseña
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// OIDCLinkTicketTTL es el tiempo que tiene el usuario para iniciar la vinculación con un proveedor externo
+const OIDCLinkTicketTTL = 5 * time.Minute
+
+// TOTPIssuer es el nombre que muestran las apps de autenticación
+const TOTPIssuer = "NovelUzu"
+
+// Duraciones por defecto, se pueden sobrescribir con ACCESS_TOKEN_TTL, REFRESH_TOKEN_TTL,
+// EMAIL_VERIFICATION_TTL, PASSWORD_RESET_TTL y EMAIL_CHANGE_TTL
+const (
+	DefaultAccessTokenTTL       = 15 * time.Minute
+	DefaultRefreshTokenTTL      = 30 * 24 * time.Hour
+	DefaultEmailVerificationTTL = 48 * time.Hour
+	DefaultPasswordResetTTL     = time.Hour
+	DefaultEmailChangeTTL       = 24 * time.Hour
+)
+
+// Eliminación de cuentas: periodo de gracia antes de borrar los datos (ACCOUNT_DELETION_GRACE)
+// y frecuencia con la que se purgan las cuentas vencidas (ACCOUNT_PURGE_INTERVAL)
+const (
+	DefaultAccountDeletionGrace = 30 * 24 * time.Hour
+	DefaultAccountPurgeInterval = time.Hour
+)
+
+// DefaultImpersonationTTL es la duración por defecto de una suplantación (IMPERSONATION_TTL);
+// MaxImpersonationTTL es el máximo que se puede pedir
+const (
+	DefaultImpersonationTTL = 30 * time.Minute
+	MaxImpersonationTTL     = 2 * time.Hour
+)
+
+// DefaultDataExportTTL es el tiempo que se puede descargar una exportación de datos (DATA_EXPORT_TTL)
+const DefaultDataExportTTL = 7 * 24 * time.Hour
+
+// Acciones que se pueden restringir a cuentas con el correo sin verificar (UNVERIFIED_RESTRICTIONS)
+const (
+	ActionComment = "comment"
+	ActionPublish = "publish"
+)
+
+// DefaultUnverifiedRestrictions se aplica si UNVERIFIED_RESTRICTIONS no está definida
+var DefaultUnverifiedRestrictions = []string{ActionComment, ActionPublish}
+
+// Permisos que se comprueban con middleware.RequirePermission
 const (
-	Email = "Email"
+	PermissionManageUsers     = "users:manage"
+	PermissionManageRoles     = "roles:manage"
+	PermissionModerateContent = "content:moderate"
+	PermissionImpersonate     = "users:impersonate"
 )
+
+// RolePermissions asigna a cada rol (models.UserRole) los permisos que concede
+var RolePermissions = map[string][]string{
+	"usuario": {},
+	"admin": {
+		PermissionManageUsers,
+		PermissionManageRoles,
+		PermissionModerateContent,
+		PermissionImpersonate,
+	},
+}
+
+// PersonalTokenPrefix identifica los tokens de acceso personal frente a los JWT
+const PersonalTokenPrefix = "nuz_pat_"
+
+// Límites de los tokens de acceso personal
+const (
+	MaxPersonalTokensPerUser     = 50
+	DefaultPersonalTokenLifetime = 90 * 24 * time.Hour
+	MaxPersonalTokenLifetime     = 365 * 24 * time.Hour
+)
+
+// Ámbitos que se pueden conceder a un token de acceso personal
+const (
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+	ScopeUsersRead     = "users:read"
+	ScopeLibraryRead   = "library:read"
+	ScopeLibraryWrite  = "library:write"
+	ScopeNovelsRead    = "novels:read"
+	ScopeNovelsWrite   = "novels:write"
+	ScopeChaptersRead  = "chapters:read"
+	ScopeChaptersWrite = "chapters:write"
+)
+
+// TokenScopes describe los ámbitos disponibles para mostrarlos al crear un token
+var TokenScopes = map[string]string{
+	ScopeProfileRead:   "Leer tu perfil",
+	ScopeProfileWrite:  "Modificar tu perfil",
+	ScopeUsersRead:     "Consultar otros usuarios",
+	ScopeLibraryRead:   "Leer tu biblioteca",
+	ScopeLibraryWrite:  "Modificar tu biblioteca",
+	ScopeNovelsRead:    "Leer tus novelas, incluidas las no publicadas",
+	ScopeNovelsWrite:   "Crear y modificar tus novelas",
+	ScopeChaptersRead:  "Leer los capítulos de tus novelas, incluidos los borradores",
+	ScopeChaptersWrite: "Crear y modificar capítulos de tus novelas",
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"NovelUzu/constants/auth"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/mailer"
+	"NovelUzu/utils/storage"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// accountPurgeBatch es el número de cuentas que se purgan en cada consulta
+const accountPurgeBatch = 100
+
+// errDeletionCancelled indica que el usuario canceló la eliminación mientras se purgaba la cuenta
+var errDeletionCancelled = errors.New("la eliminación de la cuenta se ha cancelado")
+
+// cancelScheduledDeletion anula la eliminación programada de la cuenta al iniciar sesión.
+// Devuelve true si había una eliminación pendiente
+func cancelScheduledDeletion(db *gorm.DB, user *models.User) bool {
+	if user.DeletionScheduledAt == nil {
+		return false
+	}
+
+	if err := db.Model(&models.User{}).
+		Where("email = ?", user.Email).
+		Update("deletion_scheduled_at", nil).Error; err != nil {
+		fmt.Printf("Error al cancelar la eliminación de la cuenta %s: %v\n", user.Email, err)
+		return false
+	}
+	user.DeletionScheduledAt = nil
+	return true
+}
+
+// anonymizedIdentity genera el correo y el nombre de usuario con los que queda una cuenta eliminada.
+// El dominio .invalid garantiza que nunca coincidan con una dirección real
+func anonymizedIdentity() (string, string, error) {
+	suffix, err := utils.GenerateRandomToken(12)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("eliminado-%s@noveluzu.invalid", suffix), "eliminado_" + suffix, nil
+}
+
+// purgeAccount borra los datos personales de la cuenta y deja al usuario anonimizado. El contenido
+// que haya publicado se conserva: sus claves foráneas siguen al nuevo correo (ON UPDATE CASCADE)
+func purgeAccount(db *gorm.DB, store storage.Storage, email string, now time.Time) error {
+	anonEmail, anonUsername, err := anonymizedIdentity()
+	if err != nil {
+		return err
+	}
+
+	var exports []models.DataExport
+	if err := db.Where("user_email = ?", email).Find(&exports).Error; err != nil {
+		return err
+	}
+	var user models.User
+	if err := db.Select("avatar_keys").Where("email = ?", email).First(&user).Error; err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.UserSession{},
+			&models.RecoveryCode{},
+			&models.ExternalIdentity{},
+			&models.PersonalAccessToken{},
+			&models.Notification{},
+			&models.DataExport{},
+			&models.UserPrivacySettings{},
+		} {
+			if err := tx.Where("user_email = ?", email).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		// La biblioteca, el historial de lectura, los marcadores, los logros y las estadísticas
+		// describen al usuario, no son contenido publicado: no se conservan
+		for _, table := range []string{"user_library", "reading_history", "bookmarks", "user_achievements", "user_stats"} {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE user_email = ?", email).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("follower_email = ? OR followed_email = ?", email, email).Delete(&models.UserFollow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_email = ? OR blocked_email = ?", email, email).Delete(&models.UserBlock{}).Error; err != nil {
+			return err
+		}
+		// Los eventos del usuario se conservan para la auditoría, pero sin su IP ni su navegador
+		if err := tx.Model(&models.SystemEvent{}).Where("user_email = ?", email).
+			Updates(map[string]interface{}{"ip_address": nil, "user_agent": nil}).Error; err != nil {
+			return err
+		}
+
+		// La condición evita purgar una cuenta cuyo dueño acaba de iniciar sesión
+		result := tx.Model(&models.User{}).
+			Where("email = ? AND deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", email, now).
+			Updates(map[string]interface{}{
+				"email":                      anonEmail,
+				"username":                   anonUsername,
+				"password_hash":              "",
+				"role":                       models.UserRoleUsuario,
+				"status":                     models.UserStatusInactivo,
+				"suspended_until":            nil,
+				"suspension_reason":          nil,
+				"avatar_url":                 nil,
+				"avatar_variants":            nil,
+				"avatar_keys":                "",
+				"bio":                        nil,
+				"birth_date":                 nil,
+				"country":                    nil,
+				"email_verified":             false,
+				"email_verification_token":   nil,
+				"email_verification_expires": nil,
+				"password_reset_token":       nil,
+				"password_reset_expires":     nil,
+				"pending_email":              nil,
+				"email_change_token":         nil,
+				"email_change_expires":       nil,
+				"totp_secret":                nil,
+				"totp_enabled":               false,
+				"totp_last_counter":          0,
+				"last_login":                 nil,
+				"deletion_scheduled_at":      nil,
+				"deleted_at":                 now,
+				"updated_at":                 now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errDeletionCancelled
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Las copias de datos generadas y el avatar también contienen datos personales
+	removeDataExportFiles(exports)
+	deleteStoredFiles(context.Background(), store, strings.Fields(user.AvatarKeys))
+	return nil
+}
+
+// PurgeScheduledAccounts elimina las cuentas cuyo periodo de gracia ha vencido y avisa a sus dueños.
+// Devuelve el número de cuentas eliminadas
+func PurgeScheduledAccounts(db *gorm.DB, mail mailer.Mailer, store storage.Storage) (int, error) {
+	purged := 0
+	for {
+		now := time.Now()
+		var users []models.User
+		if err := db.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", now).
+			Order("deletion_scheduled_at").
+			Limit(accountPurgeBatch).
+			Find(&users).Error; err != nil {
+			return purged, err
+		}
+
+		failed := 0
+		for _, user := range users {
+			err := purgeAccount(db, store, user.Email, now)
+			if err == errDeletionCancelled {
+				continue
+			}
+			if err != nil {
+				fmt.Printf("Error al eliminar la cuenta %s: %v\n", user.Email, err)
+				failed++
+				continue
+			}
+			purged++
+
+			if err := mail.Send(mailer.Message{
+				To:      user.Email,
+				Subject: "Tu cuenta de NovelUzu ha sido eliminada",
+				Body: fmt.Sprintf("Hola %s,\n\nTal y como solicitaste, hemos eliminado tu cuenta de NovelUzu y tus datos personales. "+
+					"Los comentarios y reseñas que publicaste se mantienen de forma anónima.\n\nGracias por haber formado parte de NovelUzu.\n",
+					user.ProfileUsername),
+			}); err != nil {
+				fmt.Printf("Error al enviar el aviso de cuenta eliminada: %v\n", err)
+			}
+		}
+
+		// Si todo el lote ha fallado se reintenta en la siguiente ejecución en lugar de repetir en bucle
+		if len(users) < accountPurgeBatch || failed == len(users) {
+			return purged, nil
+		}
+	}
+}
+
+// StartAccountPurger ejecuta PurgeScheduledAccounts en segundo plano cada ACCOUNT_PURGE_INTERVAL
+func StartAccountPurger(db *gorm.DB, mail mailer.Mailer, store storage.Storage) {
+	interval := utils.DurationFromEnv("ACCOUNT_PURGE_INTERVAL", auth.DefaultAccountPurgeInterval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purged, err := PurgeScheduledAccounts(db, mail, store)
+			if err != nil {
+				fmt.Printf("Error al purgar las cuentas eliminadas: %v\n", err)
+			} else if purged > 0 {
+				fmt.Printf("Cuentas eliminadas definitivamente: %d\n", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
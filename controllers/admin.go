@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils/realtime"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary Cambiar el rol de un usuario
+// @Description Asigna el rol usuario o admin a otro usuario. Solo para administradores
+// @Tags admin
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Param role formData string true "Nuevo rol (usuario, admin)"
+// @Success 200 {object} object{message=string,user=object{username=string,role=string}}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/users/{username}/role [put]
+func UpdateUserRole(db *gorm.DB, hub *realtime.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := models.UserRole(c.PostForm("role"))
+		if role != models.UserRoleUsuario && role != models.UserRoleAdmin {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Rol inválido. Valores permitidos: usuario, admin"})
+			return
+		}
+
+		var target models.User
+		if err := db.Where("username = ?", c.Param("username")).First(&target).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+			return
+		}
+
+		// Evitar que un administrador se quite el rol a sí mismo y deje la plataforma sin administradores
+		if target.Email == middleware.CurrentUser(c).Email && role != models.UserRoleAdmin {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No puedes quitarte el rol de administrador a ti mismo"})
+			return
+		}
+
+		previousRole := target.Role
+		if err := db.Model(&target).Updates(map[string]interface{}{
+			"role":       role,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el rol"})
+			return
+		}
+
+		if role != previousRole {
+			if _, err := Notify(db, hub, target.Email, models.NotificationSystem, "Tu rol ha cambiado",
+				fmt.Sprintf("Un administrador ha cambiado tu rol a %s", role), gin.H{"role": string(role)}); err != nil {
+				fmt.Printf("Error al notificar el cambio de rol a %s: %v\n", target.Email, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Rol actualizado exitosamente",
+			"user": gin.H{
+				"username": target.ProfileUsername,
+				"role":     string(role),
+			},
+		})
+	}
+}
+
+// @Summary Cambiar el estado de una cuenta
+// @Description Activa, desactiva, suspende o banea a un usuario. Las suspensiones pueden ser temporales (suspended_until o duration) y se levantan solas al vencer. Suspender, banear o desactivar cierra todas las sesiones del usuario
+// @Tags admin
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Param status formData string true "Nuevo estado (activo, inactivo, suspendido, baneado)"
+// @Param reason formData string false "Motivo de la suspensión o el baneo"
+// @Param suspended_until formData string false "Fin de la suspensión en formato RFC3339"
+// @Param duration formData string false "Duración de la suspensión (p. ej. 72h), alternativa a suspended_until"
+// @Success 200 {object} object{message=string,user=object{username=string,status=string,suspended_until=string,reason=string}}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/users/{username}/status [put]
+func UpdateUserStatus(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := models.UserStatus(c.PostForm("status"))
+		if !status.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Estado inválido. Valores permitidos: activo, inactivo, suspendido, baneado"})
+			return
+		}
+
+		var target models.User
+		if err := db.Where("username = ?", c.Param("username")).First(&target).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+			return
+		}
+
+		if target.Email == middleware.CurrentUser(c).Email {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No puedes cambiar el estado de tu propia cuenta"})
+			return
+		}
+
+		updates := map[string]interface{}{
+			"status":            status,
+			"suspended_until":   nil,
+			"suspension_reason": nil,
+			"updated_at":        time.Now(),
+		}
+
+		var suspendedUntil *time.Time
+		var reason *string
+		if r := c.PostForm("reason"); r != "" && status != models.UserStatusActivo {
+			reason = &r
+			updates["suspension_reason"] = r
+		}
+
+		if status == models.UserStatusSuspendido {
+			if until := c.PostForm("suspended_until"); until != "" {
+				parsed, err := time.Parse(time.RFC3339, until)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de suspended_until inválido. Use RFC3339"})
+					return
+				}
+				suspendedUntil = &parsed
+			} else if duration := c.PostForm("duration"); duration != "" {
+				d, err := time.ParseDuration(duration)
+				if err != nil || d <= 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de duration inválido (p. ej. 72h)"})
+					return
+				}
+				until := time.Now().Add(d)
+				suspendedUntil = &until
+			}
+
+			if suspendedUntil != nil {
+				if !suspendedUntil.After(time.Now()) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "La suspensión debe terminar en el futuro"})
+					return
+				}
+				updates["suspended_until"] = *suspendedUntil
+			}
+		}
+
+		if err := db.Model(&target).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el estado"})
+			return
+		}
+
+		// Cerrar las sesiones para que no se puedan seguir refrescando tokens
+		if status != models.UserStatusActivo {
+			if err := middleware.RevokeUserSessions(db, target.Email, 0); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cerrar las sesiones del usuario"})
+				return
+			}
+		}
+
+		userInfo := gin.H{
+			"username": target.ProfileUsername,
+			"status":   string(status),
+		}
+		if suspendedUntil != nil {
+			userInfo["suspended_until"] = suspendedUntil.Format("2006-01-02T15:04:05Z07:00")
+		}
+		if reason != nil {
+			userInfo["reason"] = *reason
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Estado actualizado exitosamente",
+			"user":    userInfo,
+		})
+	}
+}
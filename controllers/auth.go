@@ -1,33 +1,35 @@
 package controllers
 
 import (
-	"NovelUzu/constants/auth"
 	"NovelUzu/middleware"
 	models "NovelUzu/models/postgres"
+	"NovelUzu/utils/mailer"
+	"NovelUzu/utils/passwords"
+	"NovelUzu/utils/ratelimit"
+	"fmt"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 // @Summary Iniciar sesión
-// @Description Autentica un usuario y crea una sesión
+// @Description Autentica un usuario y crea una sesión. Si el usuario tiene 2FA activada devuelve un challenge_token que se completa en /login/2fa
 // @Tags auth
 // @Accept x-www-form-urlencoded
 // @Produce json
 // @Param email formData string true "Correo electrónico del usuario"
 // @Param password formData string true "Contraseña del usuario"
-// @Success 200 {object} object{message=string,token=string,user=object{email=string,username=string,role=string,status=string,avatar_url=string,bio=string,birth_date=string,country=string,email_verified=boolean,last_login=string,created_at=string,updated_at=string}}
+// @Success 200 {object} object{message=string,token=string,refresh_token=string,expires_at=string,two_factor_required=boolean,challenge_token=string,two_factor_setup_required=boolean,deletion_cancelled=boolean,user=object{email=string,username=string,role=string,status=string,avatar_url=string,avatar_variants=object,bio=string,birth_date=string,country=string,email_verified=boolean,totp_enabled=boolean,last_login=string,created_at=string,updated_at=string}}
 // @Failure 400 {object} object{error=string}
 // @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string,code=string,suspended_until=string,reason=string}
+// @Failure 429 {object} object{error=string,code=string,retry_after=integer}
 // @Failure 500 {object} object{error=string}
 // @Router /login [post]
-func Login(db *gorm.DB) gin.HandlerFunc {
+func Login(db *gorm.DB, guard *ratelimit.LoginGuard) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		email := c.PostForm("email")
 		password := c.PostForm("password")
@@ -38,123 +40,248 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var user models.User
-		if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario o contraseña inválidos"})
+		// Rechazar antes de calcular el hash si la cuenta o la IP están bloqueadas por fallos previos
+		ctx := c.Request.Context()
+		ip := c.ClientIP()
+		if wait, err := guard.Check(ctx, email, ip); err != nil {
+			fmt.Printf("Error al comprobar el bloqueo de login: %v\n", err)
+		} else if wait > 0 {
+			middleware.RespondTooManyRequests(c, wait)
 			return
 		}
 
-		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario o contraseña inválidos"})
+		var user models.User
+		if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+			// Se calcula un hash igualmente para que un correo inexistente no responda antes
+			passwords.VerifyDummy(password)
+			loginFailed(c, guard, email)
 			return
 		}
+		// Las cuentas sin contraseña (solo OIDC) tampoco deben distinguirse por el tiempo
+		if user.PasswordHash == "" {
+			passwords.VerifyDummy(password)
+		}
 
-		// Generate JWT
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			auth.Email: user.Email,
-		})
-
-		secret := os.Getenv("KEY")
-		tokenString, err := token.SignedString([]byte(secret))
+		valid, needsRehash, err := passwords.Verify(password, user.PasswordHash)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el JWT"})
+			fmt.Printf("Error al verificar la contraseña de %s: %v\n", user.Email, err)
+		}
+		if !valid {
+			loginFailed(c, guard, email)
 			return
 		}
 
-		// Actualizar last_login
-		now := time.Now()
-		user.LastLogin = &now
-		db.Save(&user)
-
-		// Preparar la información del usuario
-		userInfo := gin.H{
-			"email":          user.Email,
-			"username":       user.ProfileUsername,
-			"role":           string(user.Role),
-			"status":         string(user.Status),
-			"email_verified": user.EmailVerified,
-			"created_at":     user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			"updated_at":     user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		// Hashes bcrypt heredados o con parámetros antiguos se actualizan ahora que conocemos la contraseña
+		if needsRehash {
+			rehashPassword(db, &user, password)
 		}
 
-		// Agregar campos opcionales solo si no son nil
-		if user.AvatarURL != nil {
-			userInfo["avatar_url"] = *user.AvatarURL
-		}
-		if user.Bio != nil {
-			userInfo["bio"] = *user.Bio
-		}
-		if user.BirthDate != nil {
-			userInfo["birth_date"] = user.BirthDate.Format("2006-01-02")
+		// Comprobar el estado de la cuenta (las suspensiones vencidas se levantan aquí)
+		statusErr, err := middleware.CheckAccountStatus(db, &user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el estado de la cuenta"})
+			return
 		}
-		if user.Country != nil {
-			userInfo["country"] = *user.Country
+		if statusErr != nil {
+			middleware.RespondAccountStatus(c, statusErr)
+			return
 		}
-		if user.LastLogin != nil {
-			userInfo["last_login"] = user.LastLogin.Format("2006-01-02T15:04:05Z07:00")
+
+		// Con 2FA activa la contraseña no basta: se entrega un reto que se completa en /login/2fa
+		if user.TOTPEnabled {
+			challenge, expiresAt, err := middleware.GenerateTwoFactorChallenge(user.Email)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el JWT"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"message":             "Introduce el código de tu aplicación de autenticación",
+				"two_factor_required": true,
+				"challenge_token":     challenge,
+				"expires_at":          expiresAt.Format("2006-01-02T15:04:05Z07:00"),
+			})
+			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Inicio de sesión exitoso.",
-			"token":   tokenString,
-			"user":    userInfo,
-		})
+		completeLogin(c, db, guard, &user)
+	}
+}
+
+// completeLogin crea la sesión del usuario ya autenticado y responde con los tokens y su información
+func completeLogin(c *gin.Context, db *gorm.DB, guard *ratelimit.LoginGuard, user *models.User) {
+	// El contador de fallos solo se reinicia cuando el login se completa (incluida la 2FA)
+	if err := guard.Succeed(c.Request.Context(), user.Email); err != nil {
+		fmt.Printf("Error al reiniciar el bloqueo de login: %v\n", err)
+	}
+
+	// Crear la sesión y generar el JWT de acceso y el refresh token
+	tokens, err := startSession(db, c, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el JWT"})
+		return
+	}
+
+	// Iniciar sesión cancela la eliminación de la cuenta si estaba programada
+	deletionCancelled := cancelScheduledDeletion(db, user)
+
+	// Actualizar last_login
+	now := time.Now()
+	user.LastLogin = &now
+	db.Save(user)
+
+	// Preparar la información del usuario
+	userInfo := gin.H{
+		"email":          user.Email,
+		"username":       user.ProfileUsername,
+		"role":           string(user.Role),
+		"status":         string(user.Status),
+		"email_verified": user.EmailVerified,
+		"totp_enabled":   user.TOTPEnabled,
+		"created_at":     user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		"updated_at":     user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+
+	// Agregar campos opcionales solo si no son nil
+	if user.AvatarURL != nil {
+		userInfo["avatar_url"] = *user.AvatarURL
+	}
+	if len(user.AvatarVariants) > 0 {
+		userInfo["avatar_variants"] = user.AvatarVariants
+	}
+	if user.Bio != nil {
+		userInfo["bio"] = *user.Bio
+	}
+	if user.BirthDate != nil {
+		userInfo["birth_date"] = user.BirthDate.Format("2006-01-02")
+	}
+	if user.Country != nil {
+		userInfo["country"] = *user.Country
+	}
+	if user.LastLogin != nil {
+		userInfo["last_login"] = user.LastLogin.Format("2006-01-02T15:04:05Z07:00")
+	}
+
+	response := gin.H{
+		"message":       "Inicio de sesión exitoso.",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		"user":          userInfo,
+	}
+
+	// Avisar si el rol exige 2FA y aún no está activada (las rutas de administración la requieren)
+	if middleware.TwoFactorRequired(user) && !user.TOTPEnabled {
+		response["two_factor_setup_required"] = true
+	}
+	if deletionCancelled {
+		response["deletion_cancelled"] = true
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// rehashPassword sustituye el hash guardado por uno con el algoritmo y los parámetros actuales.
+// Solo se actualiza si nadie ha cambiado la contraseña mientras tanto
+func rehashPassword(db *gorm.DB, user *models.User, password string) {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		fmt.Printf("Error al regenerar el hash de la contraseña: %v\n", err)
+		return
 	}
+
+	err = db.Model(&models.User{}).
+		Where("email = ? AND password_hash = ?", user.Email, user.PasswordHash).
+		Update("password_hash", hashedPassword).Error
+	if err != nil {
+		fmt.Printf("Error al guardar el nuevo hash de la contraseña: %v\n", err)
+		return
+	}
+	user.PasswordHash = hashedPassword
+}
+
+// loginFailed registra un intento fallido y responde 401, o 429 si el fallo provoca un bloqueo
+func loginFailed(c *gin.Context, guard *ratelimit.LoginGuard, email string) {
+	wait, err := guard.Fail(c.Request.Context(), email, c.ClientIP())
+	if err != nil {
+		fmt.Printf("Error al registrar el intento de login fallido: %v\n", err)
+	}
+	if wait > 0 {
+		middleware.RespondTooManyRequests(c, wait)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario o contraseña inválidos"})
 }
 
 // @Summary Cerrar sesión
-// @Description Termina la sesión del usuario
+// @Description Revoca la sesión actual: el token de acceso y el refresh token dejan de ser válidos inmediatamente
 // @Tags auth
 // @Produce json
 // @Param Authorization header string true "Bearer JWT token"
-// @Success 200 {object} object{message=string}
-// @Failure 400 {object} object{error=string}
+// @Success 200 {object} object{mensaje=string}
+// @Failure 401 {object} object{error=string}
 // @Failure 500 {object} object{error=string}
 // @Router /auth/logout [delete]
-func Logout(c *gin.Context) {
-	//This serves no purpose with JWT so TODO rething
-	_, err := middleware.JWT_decoder(c, nil)
-	if err != nil {
-		c.Abort()
-		return
+func Logout(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := middleware.RevokeSession(db, middleware.CurrentSessionID(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cerrar la sesión"})
+			return
+		}
+
+		if impersonator := middleware.Impersonator(c); impersonator != "" {
+			if err := middleware.RecordSystemEvent(db, c, models.EventImpersonationEnded, middleware.CurrentUser(c).Email, gin.H{
+				"impersonator": impersonator,
+				"session_id":   middleware.CurrentSessionID(c),
+			}); err != nil {
+				fmt.Printf("Error al registrar el fin de la suplantación: %v\n", err)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"mensaje": "Cierre de sesión exitoso"})
 	}
-	c.JSON(http.StatusOK, gin.H{"mensaje": "Cierre de sesión exitoso"})
 }
 
-// @Summary Verificar token JWT
-// @Description Verifica si un token JWT es válido y devuelve información del usuario
+// @Summary Cerrar sesión en todos los dispositivos
+// @Description Revoca todas las sesiones del usuario, incluida la actual, y sus tokens de acceso personal
 // @Tags auth
 // @Produce json
 // @Param Authorization header string true "Bearer JWT token"
-// @Success 200 {object} object{email=string,username=string,role=string,status=string,avatar_url=string,bio=string,birth_date=string,country=string,email_verified=boolean,last_login=string,created_at=string,updated_at=string}
+// @Success 200 {object} object{mensaje=string}
 // @Failure 401 {object} object{error=string}
-// @Failure 404 {object} object{error=string}
 // @Failure 500 {object} object{error=string}
-// @Router /auth/verify-token [get]
-func VerifyTokenAndGetUser(db *gorm.DB) gin.HandlerFunc {
+// @Router /auth/logout-all [delete]
+func LogoutAll(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Extraer el email del token JWT
-		email, err := middleware.JWT_decoder(c, db)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+		user := middleware.CurrentUser(c)
+		if err := middleware.RevokeUserSessions(db, user.Email, 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cerrar las sesiones"})
 			return
 		}
-
-		// Buscar el usuario en la base de datos
-		var user models.User
-		if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+		if err := middleware.RevokePersonalTokens(db, user.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al revocar los tokens de acceso personal"})
 			return
 		}
+		c.JSON(http.StatusOK, gin.H{"mensaje": "Se han cerrado todas las sesiones"})
+	}
+}
+
+// @Summary Verificar token JWT
+// @Description Verifica si un token JWT es válido y devuelve información del usuario
+// @Tags auth
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{email=string,username=string,role=string,status=string,avatar_url=string,avatar_variants=object,bio=string,birth_date=string,country=string,email_verified=boolean,pending_email=string,last_login=string,created_at=string,updated_at=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /auth/verify-token [get]
+func VerifyTokenAndGetUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Usuario autenticado (cargado por AuthRequired)
+		user := middleware.CurrentUser(c)
 
 		// Actualizar last_login
 		now := time.Now()
 		user.LastLogin = &now
-		db.Save(&user)
+		db.Save(user)
 
 		// Preparar la respuesta con la información del usuario
 		userInfo := gin.H{
@@ -171,6 +298,9 @@ func VerifyTokenAndGetUser(db *gorm.DB) gin.HandlerFunc {
 		if user.AvatarURL != nil {
 			userInfo["avatar_url"] = *user.AvatarURL
 		}
+		if len(user.AvatarVariants) > 0 {
+			userInfo["avatar_variants"] = user.AvatarVariants
+		}
 		if user.Bio != nil {
 			userInfo["bio"] = *user.Bio
 		}
@@ -183,25 +313,28 @@ func VerifyTokenAndGetUser(db *gorm.DB) gin.HandlerFunc {
 		if user.LastLogin != nil {
 			userInfo["last_login"] = user.LastLogin.Format("2006-01-02T15:04:05Z07:00")
 		}
+		if user.PendingEmail != nil {
+			userInfo["pending_email"] = *user.PendingEmail
+		}
 
 		c.JSON(http.StatusOK, userInfo)
 	}
 }
 
 // @Summary Registrar nuevo usuario
-// @Description Crea una nueva cuenta de usuario
+// @Description Crea una nueva cuenta de usuario y envía un correo para verificar la dirección
 // @Tags auth
 // @Accept x-www-form-urlencoded
 // @Produce json
 // @Param username formData string true "Nombre de usuario"
 // @Param email formData string true "Correo electrónico"
 // @Param password formData string true "Contraseña"
-// @Success 201 {object} object{message=string,user=object{username=string,email=string}}
-// @Failure 400 {object} object{error=string}
+// @Success 201 {object} object{message=string,verification_sent=boolean,user=object{username=string,email=string}}
+// @Failure 400 {object} object{error=string,code=string,details=object{score=integer,min_score=integer,violations=[]object{code=string,message=string}}}
 // @Failure 409 {object} object{error=string}
 // @Failure 500 {object} object{error=string}
 // @Router /signup [post]
-func SignUp(db *gorm.DB) gin.HandlerFunc {
+func SignUp(db *gorm.DB, mail mailer.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		username := c.PostForm("username")
 		email := c.PostForm("email")
@@ -213,6 +346,16 @@ func SignUp(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if !validEmailAddress(email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "La dirección de correo no es válida"})
+			return
+		}
+
+		// Apply the password policy
+		if !checkNewPassword(c, password, username, email) {
+			return
+		}
+
 		// Check if user already exists
 		var existingUser models.User
 		if err := db.Where("email = ? OR username = ?", email, username).First(&existingUser).Error; err == nil {
@@ -221,7 +364,7 @@ func SignUp(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Hash password
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hashedPassword, err := hashPassword(password)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al hashear la contraseña"})
 			return
@@ -230,7 +373,7 @@ func SignUp(db *gorm.DB) gin.HandlerFunc {
 		user := models.User{
 			Email:           email,
 			ProfileUsername: username,
-			PasswordHash:    string(hashedPassword),
+			PasswordHash:    hashedPassword,
 			CreatedAt:       time.Now(),
 		}
 
@@ -241,8 +384,16 @@ func SignUp(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Enviar el correo de verificación. Si falla, el usuario puede pedir otro más tarde
+		verificationSent := true
+		if err := sendVerificationEmail(db, mail, &user); err != nil {
+			fmt.Printf("Error al enviar el correo de verificación: %v\n", err)
+			verificationSent = false
+		}
+
 		c.JSON(http.StatusCreated, gin.H{
-			"message": "Usuario creado exitosamente",
+			"message":           "Usuario creado exitosamente",
+			"verification_sent": verificationSent,
 			"user": gin.H{
 				"username": username,
 				"email":    email,
@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// isBlockedBy indica si owner ha bloqueado a other
+func isBlockedBy(db *gorm.DB, owner, other string) (bool, error) {
+	var count int64
+	err := db.Model(&models.UserBlock{}).
+		Where("user_email = ? AND blocked_email = ? AND kind = ?", owner, other, models.BlockKindBlock).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// isBlockedEither indica si alguno de los dos usuarios ha bloqueado al otro. Es la comprobación
+// para seguir, comentar en las novelas de otro usuario o responderle
+func isBlockedEither(db *gorm.DB, a, b string) (bool, error) {
+	var count int64
+	err := db.Model(&models.UserBlock{}).
+		Where("kind = ? AND ((user_email = ? AND blocked_email = ?) OR (user_email = ? AND blocked_email = ?))",
+			models.BlockKindBlock, a, b, b, a).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// isHiddenBy indica si owner ha bloqueado o silenciado a other, es decir, si no quiere saber nada de él
+func isHiddenBy(db *gorm.DB, owner, other string) (bool, error) {
+	var count int64
+	err := db.Model(&models.UserBlock{}).
+		Where("user_email = ? AND blocked_email = ?", owner, other).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// hideBlockedUsers devuelve un scope que quita de la consulta las filas cuya columna column (el
+// correo del autor de un comentario, de un evento, de un perfil...) es de un usuario que viewer
+// ha bloqueado o silenciado, o que ha bloqueado a viewer. Sin viewer no filtra nada
+func hideBlockedUsers(viewer, column string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if viewer == "" {
+			return tx
+		}
+		return tx.Where(column+" NOT IN (SELECT blocked_email FROM user_blocks WHERE user_email = ?)", viewer).
+			Where(column+" NOT IN (SELECT user_email FROM user_blocks WHERE blocked_email = ? AND kind = ?)", viewer, models.BlockKindBlock)
+	}
+}
+
+// viewerEmail devuelve el correo del usuario autenticado o "" en las rutas públicas sin token
+func viewerEmail(c *gin.Context) string {
+	if user := middleware.CurrentUser(c); user != nil {
+		return user.Email
+	}
+	return ""
+}
+
+// findBlockTarget busca al usuario que se quiere bloquear o silenciar y responde si no es válido
+func findBlockTarget(c *gin.Context, db *gorm.DB, user *models.User) (*models.User, bool) {
+	var target models.User
+	if err := db.Where("username = ?", c.Param("username")).First(&target).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+		return nil, false
+	}
+	if target.Email == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No puedes bloquearte ni silenciarte a ti mismo"})
+		return nil, false
+	}
+	return &target, true
+}
+
+// @Summary Bloquear a un usuario
+// @Description El usuario bloqueado no puede seguirte, comentar en tus novelas, responderte ni ver tu perfil. Bloquear deshace los seguimientos entre ambos y convierte en bloqueo un silencio previo
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/blocks/{username} [post]
+func BlockUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		target, ok := findBlockTarget(c, db, user)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			block := models.UserBlock{
+				UserEmail:    user.Email,
+				BlockedEmail: target.Email,
+				Kind:         models.BlockKindBlock,
+				CreatedAt:    time.Now(),
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_email"}, {Name: "blocked_email"}},
+				DoUpdates: clause.AssignmentColumns([]string{"kind", "created_at"}),
+			}).Create(&block).Error; err != nil {
+				return err
+			}
+			return tx.Where("(follower_email = ? AND followed_email = ?) OR (follower_email = ? AND followed_email = ?)",
+				user.Email, target.Email, target.Email, user.Email).
+				Delete(&models.UserFollow{}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al bloquear al usuario"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Has bloqueado a " + target.ProfileUsername})
+	}
+}
+
+// @Summary Silenciar a un usuario
+// @Description Oculta los comentarios y la actividad del usuario en tus vistas y deja de notificarte lo que haga. Él no se entera y puede seguir viendo tu perfil
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/mutes/{username} [post]
+func MuteUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		target, ok := findBlockTarget(c, db, user)
+		if !ok {
+			return
+		}
+
+		blocked, err := isBlockedBy(db, user.Email, target.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al silenciar al usuario"})
+			return
+		}
+		// Silenciar no puede rebajar un bloqueo; para eso hay que desbloquear
+		if blocked {
+			c.JSON(http.StatusConflict, gin.H{"error": "Ya has bloqueado a este usuario"})
+			return
+		}
+
+		mute := models.UserBlock{
+			UserEmail:    user.Email,
+			BlockedEmail: target.Email,
+			Kind:         models.BlockKindMute,
+			CreatedAt:    time.Now(),
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al silenciar al usuario"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Has silenciado a " + target.ProfileUsername})
+	}
+}
+
+// removeBlock atiende el desbloqueo y la retirada del silencio
+func removeBlock(db *gorm.DB, kind models.BlockKind) gin.HandlerFunc {
+	notFound, done := "No has bloqueado a este usuario", "Has desbloqueado a "
+	if kind == models.BlockKindMute {
+		notFound, done = "No has silenciado a este usuario", "Has dejado de silenciar a "
+	}
+
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		var target models.User
+		if err := db.Where("username = ?", c.Param("username")).First(&target).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+			return
+		}
+
+		result := db.Where("user_email = ? AND blocked_email = ? AND kind = ?", user.Email, target.Email, kind).
+			Delete(&models.UserBlock{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el usuario"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": done + target.ProfileUsername})
+	}
+}
+
+// @Summary Desbloquear a un usuario
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Success 200 {object} object{message=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/blocks/{username} [delete]
+func UnblockUser(db *gorm.DB) gin.HandlerFunc {
+	return removeBlock(db, models.BlockKindBlock)
+}
+
+// @Summary Dejar de silenciar a un usuario
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Success 200 {object} object{message=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/mutes/{username} [delete]
+func UnmuteUser(db *gorm.DB) gin.HandlerFunc {
+	return removeBlock(db, models.BlockKindMute)
+}
+
+// blockEntry es una fila de la lista de usuarios bloqueados o silenciados
+type blockEntry struct {
+	Username  string
+	AvatarURL *string
+	Kind      models.BlockKind
+	CreatedAt time.Time
+}
+
+// findBlockEntries devuelve los usuarios que owner ha bloqueado o silenciado, del más reciente al más antiguo
+func findBlockEntries(db *gorm.DB, owner string) ([]blockEntry, error) {
+	var entries []blockEntry
+	err := db.Table("user_blocks b").
+		Select("b.kind, b.created_at, u.username, u.avatar_url").
+		Joins("JOIN users u ON u.email = b.blocked_email").
+		Where("b.user_email = ?", owner).
+		Order("b.id DESC").
+		Scan(&entries).Error
+	return entries, err
+}
+
+// @Summary Usuarios bloqueados y silenciados
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{blocked=[]object{username=string,avatar_url=string,created_at=string},muted=[]object{username=string,avatar_url=string,created_at=string}}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/blocks [get]
+func ListBlocks(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		entries, err := findBlockEntries(db, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los usuarios bloqueados"})
+			return
+		}
+
+		blocked, muted := []gin.H{}, []gin.H{}
+		for _, entry := range entries {
+			info := gin.H{
+				"username":   entry.Username,
+				"created_at": entry.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			}
+			if entry.AvatarURL != nil {
+				info["avatar_url"] = *entry.AvatarURL
+			}
+			if entry.Kind == models.BlockKindBlock {
+				blocked = append(blocked, info)
+			} else {
+				muted = append(muted, info)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"blocked": blocked, "muted": muted})
+	}
+}
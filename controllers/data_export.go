@@ -0,0 +1,850 @@
+package controllers
+
+import (
+	"NovelUzu/constants/auth"
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/mailer"
+	"NovelUzu/utils/realtime"
+	"NovelUzu/utils/storage"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxAvatarExportSize limita el tamaño del avatar que se descarga para incluirlo en la exportación
+const maxAvatarExportSize = 10 << 20
+
+// staleDataExportAge es el tiempo tras el que una exportación que no ha terminado se da por interrumpida
+// (por ejemplo, porque el servidor se reinició mientras se generaba)
+const staleDataExportAge = time.Hour
+
+// dataExportSection es un archivo JSON de la exportación con un tipo de datos del usuario.
+// Cada nueva tabla con datos personales debe añadir aquí su sección
+type dataExportSection struct {
+	File  string
+	Fetch func(db *gorm.DB, user *models.User) (any, error)
+}
+
+var dataExportSections = []dataExportSection{
+	{File: "perfil.json", Fetch: exportProfile},
+	{File: "sesiones.json", Fetch: exportSessions},
+	{File: "notificaciones.json", Fetch: exportNotifications},
+	{File: "cuentas_vinculadas.json", Fetch: exportExternalIdentities},
+	{File: "tokens_personales.json", Fetch: exportPersonalTokens},
+	{File: "privacidad.json", Fetch: exportPrivacySettings},
+	{File: "seguidores.json", Fetch: exportFollows},
+	{File: "bloqueos.json", Fetch: exportBlocks},
+	{File: "biblioteca.json", Fetch: exportLibrary},
+	{File: "historial_lectura.json", Fetch: exportReadingHistory},
+	{File: "marcadores.json", Fetch: exportBookmarks},
+	{File: "valoraciones.json", Fetch: exportRatings},
+	{File: "comentarios.json", Fetch: exportComments},
+	{File: "logros.json", Fetch: profileAchievements},
+	{File: "estadisticas.json", Fetch: profileStats},
+}
+
+// formatOptionalTime formatea una fecha opcional como RFC3339 o nil
+func formatOptionalTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format("2006-01-02T15:04:05Z07:00")
+}
+
+func exportProfile(db *gorm.DB, user *models.User) (any, error) {
+	profile := gin.H{
+		"email":                 user.Email,
+		"username":              user.ProfileUsername,
+		"role":                  string(user.Role),
+		"status":                string(user.Status),
+		"suspended_until":       formatOptionalTime(user.SuspendedUntil),
+		"suspension_reason":     user.SuspensionReason,
+		"avatar_url":            user.AvatarURL,
+		"avatar_variants":       user.AvatarVariants,
+		"bio":                   user.Bio,
+		"country":               user.Country,
+		"email_verified":        user.EmailVerified,
+		"pending_email":         user.PendingEmail,
+		"totp_enabled":          user.TOTPEnabled,
+		"last_login":            formatOptionalTime(user.LastLogin),
+		"deletion_scheduled_at": formatOptionalTime(user.DeletionScheduledAt),
+		"created_at":            user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		"updated_at":            user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if user.BirthDate != nil {
+		profile["birth_date"] = user.BirthDate.Format("2006-01-02")
+	}
+	return profile, nil
+}
+
+func exportSessions(db *gorm.DB, user *models.User) (any, error) {
+	var sessions []models.UserSession
+	if err := db.Where("user_email = ?", user.Email).Order("created_at").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, gin.H{
+			"ip_address":   session.IPAddress,
+			"user_agent":   session.UserAgent,
+			"created_at":   session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			"last_seen_at": formatOptionalTime(session.LastSeenAt),
+			"expires_at":   session.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+			"revoked_at":   formatOptionalTime(session.RevokedAt),
+		})
+	}
+	return result, nil
+}
+
+func exportNotifications(db *gorm.DB, user *models.User) (any, error) {
+	var notifications []models.Notification
+	if err := db.Where("user_email = ?", user.Email).Order("id").Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(notifications))
+	for i := range notifications {
+		result = append(result, notificationInfo(&notifications[i]))
+	}
+	return result, nil
+}
+
+func exportExternalIdentities(db *gorm.DB, user *models.User) (any, error) {
+	var identities []models.ExternalIdentity
+	if err := db.Where("user_email = ?", user.Email).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(identities))
+	for _, identity := range identities {
+		result = append(result, gin.H{
+			"provider":   identity.Provider,
+			"subject":    identity.Subject,
+			"email":      identity.Email,
+			"created_at": identity.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+func exportPersonalTokens(db *gorm.DB, user *models.User) (any, error) {
+	var tokens []models.PersonalAccessToken
+	if err := db.Where("user_email = ?", user.Email).Order("created_at").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(tokens))
+	for i := range tokens {
+		info := personalTokenInfo(&tokens[i])
+		info["revoked_at"] = formatOptionalTime(tokens[i].RevokedAt)
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+func exportPrivacySettings(db *gorm.DB, user *models.User) (any, error) {
+	settings, err := loadPrivacySettings(db, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	return privacyInfo(&settings), nil
+}
+
+func exportFollows(db *gorm.DB, user *models.User) (any, error) {
+	result := gin.H{}
+	for key, columns := range map[string][2]string{
+		"following": {"f.follower_email", "f.followed_email"},
+		"followers": {"f.followed_email", "f.follower_email"},
+	} {
+		var entries []followEntry
+		if err := db.Table("user_follows f").
+			Select("f.id, f.created_at, u.username").
+			Joins("JOIN users u ON u.email = "+columns[1]).
+			Where(columns[0]+" = ?", user.Email).
+			Order("f.id").Scan(&entries).Error; err != nil {
+			return nil, err
+		}
+		list := make([]gin.H, 0, len(entries))
+		for _, entry := range entries {
+			list = append(list, gin.H{
+				"username":    entry.Username,
+				"followed_at": entry.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			})
+		}
+		result[key] = list
+	}
+	return result, nil
+}
+
+func exportBlocks(db *gorm.DB, user *models.User) (any, error) {
+	entries, err := findBlockEntries(db, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, gin.H{
+			"username":   entry.Username,
+			"kind":       string(entry.Kind),
+			"created_at": entry.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+func exportLibrary(db *gorm.DB, user *models.User) (any, error) {
+	var entries []struct {
+		NovelID        uint
+		NovelTitle     string
+		Status         string
+		IsFavorite     bool
+		PersonalRating *int
+		PersonalNotes  *string
+		AddedAt        time.Time
+		UpdatedAt      time.Time
+	}
+	if err := db.Table("user_library l").
+		Select("l.novel_id, n.title AS novel_title, l.status, l.is_favorite, l.personal_rating, l.personal_notes, l.added_at, l.updated_at").
+		Joins("JOIN novels n ON n.id = l.novel_id").
+		Where("l.user_email = ?", user.Email).
+		Order("l.added_at").Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, gin.H{
+			"novel_id":        entry.NovelID,
+			"novel_title":     entry.NovelTitle,
+			"status":          entry.Status,
+			"is_favorite":     entry.IsFavorite,
+			"personal_rating": entry.PersonalRating,
+			"personal_notes":  entry.PersonalNotes,
+			"added_at":        entry.AddedAt.Format("2006-01-02T15:04:05Z07:00"),
+			"updated_at":      entry.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+func exportReadingHistory(db *gorm.DB, user *models.User) (any, error) {
+	var entries []struct {
+		NovelID            uint
+		NovelTitle         string
+		ChapterID          uint
+		ChapterTitle       string
+		ProgressPercentage float64
+		LastReadPosition   int
+		ReadAt             time.Time
+	}
+	if err := db.Table("reading_history h").
+		Select("h.novel_id, n.title AS novel_title, h.chapter_id, c.title AS chapter_title, h.progress_percentage, h.last_read_position, h.read_at").
+		Joins("JOIN novels n ON n.id = h.novel_id").
+		Joins("JOIN chapters c ON c.id = h.chapter_id").
+		Where("h.user_email = ?", user.Email).
+		Order("h.read_at").Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, gin.H{
+			"novel_id":            entry.NovelID,
+			"novel_title":         entry.NovelTitle,
+			"chapter_id":          entry.ChapterID,
+			"chapter_title":       entry.ChapterTitle,
+			"progress_percentage": entry.ProgressPercentage,
+			"last_read_position":  entry.LastReadPosition,
+			"read_at":             entry.ReadAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+func exportBookmarks(db *gorm.DB, user *models.User) (any, error) {
+	var entries []struct {
+		ChapterID    uint
+		ChapterTitle string
+		NovelTitle   string
+		Position     int
+		Note         *string
+		CreatedAt    time.Time
+	}
+	if err := db.Table("bookmarks b").
+		Select("b.chapter_id, c.title AS chapter_title, n.title AS novel_title, b.position, b.note, b.created_at").
+		Joins("JOIN chapters c ON c.id = b.chapter_id").
+		Joins("JOIN novels n ON n.id = c.novel_id").
+		Where("b.user_email = ?", user.Email).
+		Order("b.created_at").Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, gin.H{
+			"chapter_id":    entry.ChapterID,
+			"chapter_title": entry.ChapterTitle,
+			"novel_title":   entry.NovelTitle,
+			"position":      entry.Position,
+			"note":          entry.Note,
+			"created_at":    entry.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+func exportRatings(db *gorm.DB, user *models.User) (any, error) {
+	var entries []struct {
+		NovelID    uint
+		NovelTitle string
+		Rating     *int
+		Review     *string
+		CreatedAt  time.Time
+		UpdatedAt  time.Time
+	}
+	if err := db.Table("ratings r").
+		Select("r.novel_id, n.title AS novel_title, r.rating, r.review, r.created_at, r.updated_at").
+		Joins("JOIN novels n ON n.id = r.novel_id").
+		Where("r.user_email = ?", user.Email).
+		Order("r.created_at").Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, gin.H{
+			"novel_id":    entry.NovelID,
+			"novel_title": entry.NovelTitle,
+			"rating":      entry.Rating,
+			"review":      entry.Review,
+			"created_at":  entry.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			"updated_at":  entry.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+func exportComments(db *gorm.DB, user *models.User) (any, error) {
+	var entries []struct {
+		ID         uint
+		NovelID    *uint
+		NovelTitle *string
+		ChapterID  *uint
+		ParentID   *uint
+		Content    string
+		Status     string
+		IsSpoiler  bool
+		CreatedAt  time.Time
+		UpdatedAt  time.Time
+	}
+	if err := db.Table("comments c").
+		Select("c.id, c.novel_id, n.title AS novel_title, c.chapter_id, c.parent_id, c.content, c.status, c.is_spoiler, c.created_at, c.updated_at").
+		Joins("LEFT JOIN novels n ON n.id = c.novel_id").
+		Where("c.user_email = ?", user.Email).
+		Order("c.id").Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, gin.H{
+			"id":          entry.ID,
+			"novel_id":    entry.NovelID,
+			"novel_title": entry.NovelTitle,
+			"chapter_id":  entry.ChapterID,
+			"parent_id":   entry.ParentID,
+			"content":     entry.Content,
+			"status":      entry.Status,
+			"is_spoiler":  entry.IsSpoiler,
+			"created_at":  entry.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			"updated_at":  entry.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+// dataExportDir devuelve el directorio donde se guardan los ZIP (DATA_EXPORT_DIR, por defecto "exports")
+func dataExportDir() string {
+	if dir := os.Getenv("DATA_EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return "exports"
+}
+
+// avatarExportKey elige, entre los archivos del avatar, el JPEG más grande
+func avatarExportKey(avatarKeys string) string {
+	best, bestSize := "", -1
+	for _, key := range strings.Fields(avatarKeys) {
+		name := strings.TrimSuffix(path.Base(key), ".jpg")
+		if name == path.Base(key) {
+			continue
+		}
+		size, err := strconv.Atoi(name[strings.LastIndex(name, "_")+1:])
+		if err == nil && size > bestSize {
+			best, bestSize = key, size
+		}
+	}
+	return best
+}
+
+// readAvatar lee el avatar del usuario. Los subidos con el almacenamiento actual se leen por su
+// clave; los anteriores, que solo tienen URL, se descargan. Devuelve el contenido y la extensión
+func readAvatar(ctx context.Context, store storage.Storage, user *models.User) ([]byte, string, error) {
+	key := avatarExportKey(user.AvatarKeys)
+	if key == "" {
+		return fetchAvatar(*user.AvatarURL)
+	}
+
+	object, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(io.LimitReader(object, maxAvatarExportSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxAvatarExportSize {
+		return nil, "", fmt.Errorf("el avatar supera el tamaño máximo")
+	}
+	return data, path.Ext(key), nil
+}
+
+// fetchAvatar descarga un avatar por su URL. Devuelve el contenido y la extensión del archivo
+func fetchAvatar(avatarURL string) ([]byte, string, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(avatarURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("respuesta inesperada al descargar el avatar: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarExportSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxAvatarExportSize {
+		return nil, "", fmt.Errorf("el avatar supera el tamaño máximo")
+	}
+
+	ext := ""
+	if parsed, err := url.Parse(avatarURL); err == nil {
+		ext = strings.ToLower(path.Ext(parsed.Path))
+	}
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(resp.Header.Get("Content-Type")); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return data, ext, nil
+}
+
+// writeDataExport genera el ZIP con todos los datos del usuario y devuelve su ruta y tamaño
+func writeDataExport(db *gorm.DB, store storage.Storage, user *models.User, exportID uint) (string, int64, error) {
+	dir := dataExportDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, err
+	}
+
+	suffix, err := utils.GenerateRandomToken(12)
+	if err != nil {
+		return "", 0, err
+	}
+	filePath := filepath.Join(dir, fmt.Sprintf("export-%d-%s.zip", exportID, suffix))
+
+	// Se escribe en un temporal para no dejar nunca un ZIP a medias con el nombre definitivo
+	tmp, err := os.CreateTemp(dir, "export-*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	archive := zip.NewWriter(tmp)
+	files := make([]string, 0, len(dataExportSections)+1)
+	for _, section := range dataExportSections {
+		data, err := section.Fetch(db, user)
+		if err != nil {
+			return "", 0, fmt.Errorf("%s: %w", section.File, err)
+		}
+		if err := writeZipJSON(archive, section.File, data); err != nil {
+			return "", 0, err
+		}
+		files = append(files, section.File)
+	}
+
+	// El avatar se guarda en el almacenamiento de archivos; si no se puede leer se indica en el índice
+	var avatarError *string
+	if user.AvatarURL != nil && *user.AvatarURL != "" {
+		data, ext, err := readAvatar(context.Background(), store, user)
+		if err != nil {
+			message := err.Error()
+			avatarError = &message
+		} else {
+			w, err := archive.Create("avatar" + ext)
+			if err != nil {
+				return "", 0, err
+			}
+			if _, err := w.Write(data); err != nil {
+				return "", 0, err
+			}
+			files = append(files, "avatar"+ext)
+		}
+	}
+
+	if err := writeZipJSON(archive, "indice.json", gin.H{
+		"generated_at": time.Now().Format("2006-01-02T15:04:05Z07:00"),
+		"email":        user.Email,
+		"username":     user.ProfileUsername,
+		"files":        files,
+		"avatar_error": avatarError,
+	}); err != nil {
+		return "", 0, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return "", 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return "", 0, err
+	}
+	return filePath, info.Size(), nil
+}
+
+// writeZipJSON añade al ZIP un archivo con el valor serializado como JSON legible
+func writeZipJSON(archive *zip.Writer, name string, value any) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// buildDataExport genera en segundo plano la exportación indicada y avisa al usuario cuando está lista
+func buildDataExport(db *gorm.DB, hub *realtime.Hub, mailSender mailer.Mailer, store storage.Storage, exportID uint) {
+	// La actualización condicional evita que dos procesos generen la misma exportación
+	result := db.Model(&models.DataExport{}).
+		Where("id = ? AND status = ?", exportID, models.DataExportPendiente).
+		Update("status", models.DataExportProcesando)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	var export models.DataExport
+	var user models.User
+	err := db.First(&export, exportID).Error
+	if err == nil {
+		err = db.Where("email = ?", export.UserEmail).First(&user).Error
+	}
+
+	var filePath string
+	var size int64
+	if err == nil {
+		filePath, size, err = writeDataExport(db, store, &user, exportID)
+	}
+	if err != nil {
+		fmt.Printf("Error al generar la exportación de datos %d: %v\n", exportID, err)
+		message := err.Error()
+		db.Model(&models.DataExport{}).Where("id = ?", exportID).Updates(map[string]interface{}{
+			"status": models.DataExportError,
+			"error":  message,
+		})
+		if export.UserEmail != "" {
+			if _, err := Notify(db, hub, export.UserEmail, models.NotificationSystem, "No se ha podido generar tu copia de datos",
+				"Ha ocurrido un error al preparar la exportación de tus datos. Vuelve a solicitarla más tarde",
+				gin.H{"export_id": exportID}); err != nil {
+				fmt.Printf("Error al notificar el fallo de la exportación %d: %v\n", exportID, err)
+			}
+		}
+		return
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		os.Remove(filePath)
+		db.Model(&models.DataExport{}).Where("id = ?", exportID).Update("status", models.DataExportError)
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(utils.DurationFromEnv("DATA_EXPORT_TTL", auth.DefaultDataExportTTL))
+	if err := db.Model(&models.DataExport{}).Where("id = ?", exportID).Updates(map[string]interface{}{
+		"status":       models.DataExportListo,
+		"file_path":    filePath,
+		"file_size":    size,
+		"token_hash":   utils.HashToken(token),
+		"expires_at":   expires,
+		"completed_at": now,
+	}).Error; err != nil {
+		fmt.Printf("Error al guardar la exportación de datos %d: %v\n", exportID, err)
+		os.Remove(filePath)
+		return
+	}
+
+	if _, err := Notify(db, hub, user.Email, models.NotificationSystem, "Tu copia de datos está lista",
+		fmt.Sprintf("Puedes descargar la exportación de tus datos hasta el %s", expires.Format("02/01/2006 15:04")),
+		gin.H{"export_id": exportID, "expires_at": expires.Format("2006-01-02T15:04:05Z07:00")}); err != nil {
+		fmt.Printf("Error al notificar la exportación %d: %v\n", exportID, err)
+	}
+
+	if err := mailSender.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Tu copia de datos de NovelUzu está lista",
+		Body: fmt.Sprintf("Hola %s,\n\nHemos preparado la copia de los datos de tu cuenta que solicitaste. Puedes descargarla desde el siguiente enlace:\n\n%s\n\n"+
+			"El enlace caduca el %s. Si no has solicitado esta copia, cambia tu contraseña y cierra las demás sesiones desde tu perfil.\n",
+			user.ProfileUsername, frontendLink("/data-export", token), expires.Format("02/01/2006 15:04")),
+	}); err != nil {
+		fmt.Printf("Error al enviar el aviso de exportación de datos: %v\n", err)
+	}
+}
+
+// dataExportInfo es la representación pública de una exportación (sin ruta ni token)
+func dataExportInfo(export *models.DataExport) gin.H {
+	info := gin.H{
+		"id":         export.ID,
+		"status":     string(export.Status),
+		"created_at": export.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if export.Status == models.DataExportListo {
+		info["size"] = export.FileSize
+	}
+	if export.CompletedAt != nil {
+		info["completed_at"] = export.CompletedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if export.ExpiresAt != nil {
+		info["expires_at"] = export.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return info
+}
+
+// serveDataExport envía el ZIP si la exportación está lista y no ha caducado
+func serveDataExport(c *gin.Context, export *models.DataExport) {
+	if export.Status != models.DataExportListo || export.FilePath == nil ||
+		export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "La exportación no está disponible o ha caducado"})
+		return
+	}
+	if _, err := os.Stat(*export.FilePath); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "La exportación no está disponible o ha caducado"})
+		return
+	}
+
+	c.FileAttachment(*export.FilePath, fmt.Sprintf("noveluzu-datos-%s.zip", export.CreatedAt.Format("2006-01-02")))
+}
+
+// @Summary Solicitar una copia de los datos personales
+// @Description Genera en segundo plano un ZIP con todos los datos de la cuenta (JSON y avatar). Al terminar se envía una notificación y un correo con el enlace de descarga, que caduca
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 202 {object} object{message=string,export=object{id=integer,status=string,created_at=string}}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string,code=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 429 {object} object{error=string,code=string,retry_after=integer}
+// @Failure 500 {object} object{error=string}
+// @Router /user/exports [post]
+func RequestDataExport(db *gorm.DB, hub *realtime.Hub, mailSender mailer.Mailer, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		var inProgress int64
+		if err := db.Model(&models.DataExport{}).
+			Where("user_email = ? AND status IN ?", user.Email, []models.DataExportStatus{models.DataExportPendiente, models.DataExportProcesando}).
+			Count(&inProgress).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al solicitar la exportación"})
+			return
+		}
+		if inProgress > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Ya hay una exportación de tus datos en curso"})
+			return
+		}
+
+		export := models.DataExport{
+			UserEmail: user.Email,
+			Status:    models.DataExportPendiente,
+			CreatedAt: time.Now(),
+		}
+		if err := db.Create(&export).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al solicitar la exportación"})
+			return
+		}
+
+		go buildDataExport(db, hub, mailSender, store, export.ID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Estamos preparando la copia de tus datos. Te avisaremos cuando esté lista",
+			"export":  dataExportInfo(&export),
+		})
+	}
+}
+
+// @Summary Listar exportaciones de datos
+// @Description Devuelve las últimas exportaciones de datos solicitadas y su estado
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{exports=[]object{id=integer,status=string,size=integer,created_at=string,completed_at=string,expires_at=string}}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string,code=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/exports [get]
+func ListDataExports(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var exports []models.DataExport
+		if err := db.Where("user_email = ?", middleware.CurrentUser(c).Email).
+			Order("created_at DESC").
+			Limit(10).
+			Find(&exports).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las exportaciones"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(exports))
+		for i := range exports {
+			result = append(result, dataExportInfo(&exports[i]))
+		}
+		c.JSON(http.StatusOK, gin.H{"exports": result})
+	}
+}
+
+// @Summary Descargar una exportación de datos
+// @Description Descarga el ZIP de una exportación propia que esté lista
+// @Tags user
+// @Produce application/zip
+// @Param Authorization header string true "Bearer JWT token"
+// @Param id path int true "Identificador de la exportación"
+// @Success 200 {file} file
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 410 {object} object{error=string}
+// @Router /user/exports/{id}/download [get]
+func DownloadDataExport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Identificador de exportación inválido"})
+			return
+		}
+
+		var export models.DataExport
+		if err := db.Where("id = ? AND user_email = ?", id, middleware.CurrentUser(c).Email).First(&export).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exportación no encontrada"})
+			return
+		}
+
+		serveDataExport(c, &export)
+	}
+}
+
+// @Summary Descargar una exportación de datos con el enlace del correo
+// @Description Descarga el ZIP con el token enviado por correo, sin necesidad de iniciar sesión. El enlace caduca
+// @Tags auth
+// @Produce application/zip
+// @Param token query string true "Token de descarga recibido por correo"
+// @Success 200 {file} file
+// @Failure 400 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 410 {object} object{error=string}
+// @Router /exports/download [get]
+func DownloadDataExportByToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(c.Query("token"))
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parametro token es obligatorio"})
+			return
+		}
+
+		var export models.DataExport
+		if err := db.Where("token_hash = ?", utils.HashToken(token)).First(&export).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Enlace de descarga inválido"})
+			return
+		}
+
+		serveDataExport(c, &export)
+	}
+}
+
+// removeDataExportFiles borra del disco los ZIP de las exportaciones indicadas
+func removeDataExportFiles(exports []models.DataExport) {
+	for _, export := range exports {
+		if export.FilePath == nil {
+			continue
+		}
+		if err := os.Remove(*export.FilePath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error al borrar la exportación %d: %v\n", export.ID, err)
+		}
+	}
+}
+
+// cleanDataExports borra los ZIP caducados y marca como fallidas las exportaciones interrumpidas
+func cleanDataExports(db *gorm.DB) error {
+	now := time.Now()
+	var expired []models.DataExport
+	if err := db.Where("status = ? AND expires_at <= ?", models.DataExportListo, now).Find(&expired).Error; err != nil {
+		return err
+	}
+	removeDataExportFiles(expired)
+	for _, export := range expired {
+		if err := db.Model(&export).Updates(map[string]interface{}{
+			"status":     models.DataExportCaducado,
+			"file_path":  nil,
+			"token_hash": nil,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Model(&models.DataExport{}).
+		Where("status IN ? AND created_at <= ?", []models.DataExportStatus{models.DataExportPendiente, models.DataExportProcesando}, now.Add(-staleDataExportAge)).
+		Updates(map[string]interface{}{
+			"status": models.DataExportError,
+			"error":  "La exportación se interrumpió antes de terminar",
+		}).Error
+}
+
+// StartDataExportCleaner ejecuta cleanDataExports en segundo plano cada hora
+func StartDataExportCleaner(db *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			if err := cleanDataExports(db); err != nil {
+				fmt.Printf("Error al limpiar las exportaciones de datos: %v\n", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"NovelUzu/constants/auth"
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/mailer"
+	"NovelUzu/utils/passwords"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// validEmailAddress comprueba que el valor es una dirección de correo simple (sin nombre ni <>)
+func validEmailAddress(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email && len(email) <= 255
+}
+
+// emailInUse indica si el correo ya pertenece a otra cuenta
+func emailInUse(db *gorm.DB, email string) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).Where("LOWER(email) = LOWER(?)", email).Count(&count).Error
+	return count > 0, err
+}
+
+// @Summary Solicitar cambio de correo
+// @Description Inicia el cambio de correo electrónico. Se envía un enlace de confirmación a la nueva dirección y un aviso a la actual; el cambio no se aplica hasta confirmarlo
+// @Tags user
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param new_email formData string true "Nueva dirección de correo"
+// @Param password formData string true "Contraseña actual"
+// @Success 200 {object} object{message=string,pending_email=string,expires_at=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/email [post]
+func RequestEmailChange(db *gorm.DB, mailSender mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+		newEmail := strings.TrimSpace(c.PostForm("new_email"))
+		password := c.PostForm("password")
+
+		if newEmail == "" || password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "new_email y password son obligatorios"})
+			return
+		}
+		if !validEmailAddress(newEmail) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "La dirección de correo no es válida"})
+			return
+		}
+		if strings.EqualFold(newEmail, user.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El nuevo correo debe ser diferente al actual"})
+			return
+		}
+
+		if !passwords.Matches(password, user.PasswordHash) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Contraseña incorrecta"})
+			return
+		}
+
+		inUse, err := emailInUse(db, newEmail)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al solicitar el cambio de correo"})
+			return
+		}
+		if inUse {
+			c.JSON(http.StatusConflict, gin.H{"error": "Ese correo ya está en uso"})
+			return
+		}
+
+		token, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al solicitar el cambio de correo"})
+			return
+		}
+
+		// Una nueva solicitud sustituye a la anterior, cuyo enlace deja de funcionar
+		expires := time.Now().Add(utils.DurationFromEnv("EMAIL_CHANGE_TTL", auth.DefaultEmailChangeTTL))
+		if err := db.Model(user).Updates(map[string]interface{}{
+			"pending_email":        newEmail,
+			"email_change_token":   utils.HashToken(token),
+			"email_change_expires": expires,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al solicitar el cambio de correo"})
+			return
+		}
+
+		if err := mailSender.Send(mailer.Message{
+			To:      newEmail,
+			Subject: "Confirma tu nuevo correo en NovelUzu",
+			Body: fmt.Sprintf("Hola %s,\n\nHas solicitado usar esta dirección en tu cuenta de NovelUzu. Para confirmarlo abre el siguiente enlace:\n\n%s\n\n"+
+				"El enlace caduca el %s. Si no has sido tú puedes ignorar este mensaje.\n",
+				user.ProfileUsername, frontendLink("/confirm-email", token), expires.Format("02/01/2006 15:04")),
+		}); err != nil {
+			fmt.Printf("Error al enviar la confirmación del cambio de correo: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al enviar el correo de confirmación"})
+			return
+		}
+
+		// El aviso a la dirección actual permite detectar un cambio no autorizado a tiempo
+		if err := mailSender.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Solicitud de cambio de correo en NovelUzu",
+			Body: fmt.Sprintf("Hola %s,\n\nSe ha solicitado cambiar el correo de tu cuenta de NovelUzu a %s. El cambio no se aplicará hasta que se confirme desde esa dirección.\n\n"+
+				"Si no has sido tú, cambia tu contraseña y cierra las demás sesiones desde tu perfil.\n",
+				user.ProfileUsername, newEmail),
+		}); err != nil {
+			fmt.Printf("Error al enviar el aviso de cambio de correo: %v\n", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "Te hemos enviado un enlace de confirmación al nuevo correo",
+			"pending_email": newEmail,
+			"expires_at":    expires.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+}
+
+// @Summary Cancelar cambio de correo
+// @Description Anula la solicitud de cambio de correo pendiente
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{message=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/email [delete]
+func CancelEmailChange(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := db.Model(middleware.CurrentUser(c)).Updates(map[string]interface{}{
+			"pending_email":        nil,
+			"email_change_token":   nil,
+			"email_change_expires": nil,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cancelar el cambio de correo"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Cambio de correo cancelado"})
+	}
+}
+
+// @Summary Confirmar cambio de correo
+// @Description Aplica el cambio de correo con el token enviado a la nueva dirección. Todos los datos de la cuenta pasan al nuevo correo y se cierran todas las sesiones
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token recibido en el nuevo correo"
+// @Success 200 {object} object{message=string,email=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /email/confirm [post]
+func ConfirmEmailChange(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(c.PostForm("token"))
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parametro token es obligatorio"})
+			return
+		}
+
+		var user models.User
+		if err := db.Where("email_change_token = ?", utils.HashToken(token)).First(&user).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Token de confirmación inválido"})
+			return
+		}
+		if user.PendingEmail == nil || user.EmailChangeExpires == nil || time.Now().After(*user.EmailChangeExpires) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El token de confirmación ha caducado"})
+			return
+		}
+
+		oldEmail, newEmail := user.Email, *user.PendingEmail
+		conflict := false
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Alguien puede haberse registrado con ese correo mientras tanto
+			inUse, err := emailInUse(tx, newEmail)
+			if err != nil {
+				return err
+			}
+			if inUse {
+				conflict = true
+				return nil
+			}
+
+			// Cambiar la clave primaria: las claves foráneas ON UPDATE CASCADE llevan al nuevo correo
+			// las sesiones, tokens, códigos de recuperación e identidades vinculadas
+			result := tx.Model(&models.User{}).
+				Where("email = ? AND email_change_token = ?", oldEmail, utils.HashToken(token)).
+				Updates(map[string]interface{}{
+					"email":                newEmail,
+					"email_verified":       true,
+					"pending_email":        nil,
+					"email_change_token":   nil,
+					"email_change_expires": nil,
+					"updated_at":           time.Now(),
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return nil
+		})
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Token de confirmación inválido"})
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error al cambiar el correo de %s: %v\n", oldEmail, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cambiar el correo"})
+			return
+		}
+		if conflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "Ese correo ya está en uso"})
+			return
+		}
+
+		// Los tokens emitidos llevan el correo antiguo: se cierran todas las sesiones. La caché de
+		// sesiones está indexada por el correo con el que se emitieron, así que se limpian ambos
+		if err := middleware.RevokeUserSessions(db, newEmail, 0); err != nil {
+			fmt.Printf("Error al cerrar las sesiones tras el cambio de correo: %v\n", err)
+		}
+		middleware.RevokeUserSessions(db, oldEmail, 0)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Correo cambiado exitosamente. Inicia sesión con tu nueva dirección",
+			"email":   newEmail,
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package controllers
+
+import (
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxFollowsPage = 100
+	maxFeedPage    = 100
+)
+
+// followCounts devuelve cuántos seguidores tiene el usuario y a cuántos sigue, sin contar cuentas ocultas
+func followCounts(db *gorm.DB, email string) (followers int64, following int64, err error) {
+	err = db.Table("user_follows f").
+		Joins("JOIN users u ON u.email = f.follower_email AND u.deleted_at IS NULL").
+		Where("f.followed_email = ? AND u.status NOT IN ?", email, hiddenUserStatuses).
+		Count(&followers).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	err = db.Table("user_follows f").
+		Joins("JOIN users u ON u.email = f.followed_email AND u.deleted_at IS NULL").
+		Where("f.follower_email = ? AND u.status NOT IN ?", email, hiddenUserStatuses).
+		Count(&following).Error
+	return followers, following, err
+}
+
+// parsePageParams lee limit (entre 1 y max, por defecto 20) y before_id
+func parsePageParams(c *gin.Context, max int) (int, uint64, string) {
+	limit := 20
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > max {
+			return 0, 0, fmt.Sprintf("limit debe estar entre 1 y %d", max)
+		}
+		limit = n
+	}
+	var beforeID uint64
+	if value := c.Query("before_id"); value != "" {
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return 0, 0, "before_id inválido"
+		}
+		beforeID = n
+	}
+	return limit, beforeID, ""
+}
+
+// @Summary Seguir a un usuario
+// @Description Sigue a un autor para ver su actividad (novelas, capítulos y anuncios) en el feed. Seguir de nuevo a alguien no tiene efecto
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Success 200 {object} object{message=string,followers_count=integer}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/follows/{username} [post]
+func FollowUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		target, err := findPublicUser(db, c.Param("username"))
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+			return
+		}
+		if target.Email == user.Email {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No puedes seguirte a ti mismo"})
+			return
+		}
+
+		blocked, err := isBlockedEither(db, user.Email, target.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al seguir al usuario"})
+			return
+		}
+		if blocked {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No puedes seguir a este usuario"})
+			return
+		}
+
+		follow := models.UserFollow{
+			FollowerEmail: user.Email,
+			FollowedEmail: target.Email,
+			CreatedAt:     time.Now(),
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al seguir al usuario"})
+			return
+		}
+
+		followers, _, err := followCounts(db, target.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al seguir al usuario"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":         "Ahora sigues a " + target.ProfileUsername,
+			"followers_count": followers,
+		})
+	}
+}
+
+// @Summary Dejar de seguir a un usuario
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Success 200 {object} object{message=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/follows/{username} [delete]
+func UnfollowUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		// Se busca sin filtrar por estado para poder dejar de seguir a una cuenta baneada
+		var target models.User
+		if err := db.Where("username = ?", c.Param("username")).First(&target).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+			return
+		}
+
+		result := db.Where("follower_email = ? AND followed_email = ?", user.Email, target.Email).Delete(&models.UserFollow{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al dejar de seguir al usuario"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No sigues a este usuario"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Has dejado de seguir a " + target.ProfileUsername})
+	}
+}
+
+// followEntry es una fila de las listas de seguidores y seguidos
+type followEntry struct {
+	ID        uint
+	Username  string
+	AvatarURL *string
+	CreatedAt time.Time
+}
+
+// listFollows atiende las listas de seguidores (followers) y seguidos (following) de un usuario
+func listFollows(db *gorm.DB, followers bool) gin.HandlerFunc {
+	// ownColumn es la columna del usuario consultado y otherColumn la de los usuarios listados
+	ownColumn, otherColumn, key := "f.followed_email", "f.follower_email", "followers"
+	if !followers {
+		ownColumn, otherColumn, key = "f.follower_email", "f.followed_email", "following"
+	}
+
+	return func(c *gin.Context) {
+		limit, beforeID, message := parsePageParams(c, maxFollowsPage)
+		if message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+
+		viewer := viewerEmail(c)
+		target, err := findVisibleUser(db, c.Param("username"), viewer)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+			return
+		}
+
+		followersCount, followingCount, err := followCounts(db, target.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la lista"})
+			return
+		}
+
+		query := db.Table("user_follows f").
+			Select("f.id, f.created_at, u.username, u.avatar_url").
+			Joins("JOIN users u ON u.email = "+otherColumn+" AND u.deleted_at IS NULL").
+			Where(ownColumn+" = ? AND u.status NOT IN ?", target.Email, hiddenUserStatuses).
+			Scopes(hideBlockedUsers(viewer, "u.email"))
+		if beforeID > 0 {
+			query = query.Where("f.id < ?", beforeID)
+		}
+
+		var entries []followEntry
+		if err := query.Order("f.id DESC").Limit(limit).Scan(&entries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la lista"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(entries))
+		for _, entry := range entries {
+			info := gin.H{
+				"id":          entry.ID,
+				"username":    entry.Username,
+				"followed_at": entry.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			}
+			if entry.AvatarURL != nil {
+				info["avatar_url"] = *entry.AvatarURL
+			}
+			result = append(result, info)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			key:               result,
+			"followers_count": followersCount,
+			"following_count": followingCount,
+		})
+	}
+}
+
+// @Summary Seguidores de un usuario
+// @Description Lista de quienes siguen al usuario, de la más reciente a la más antigua. Para paginar se pasa en before_id el id del último recibido. Con token se ocultan los usuarios bloqueados o silenciados; sin token se devuelve la vista pública
+// @Tags users
+// @Produce json
+// @Param Authorization header string false "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Param limit query int false "Número máximo de usuarios (por defecto 20, máximo 100)"
+// @Param before_id query int false "Devolver solo los anteriores a este id"
+// @Success 200 {object} object{followers=[]object{id=integer,username=string,avatar_url=string,followed_at=string},followers_count=integer,following_count=integer}
+// @Failure 400 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /users/{username}/followers [get]
+func ListFollowers(db *gorm.DB) gin.HandlerFunc {
+	return listFollows(db, true)
+}
+
+// @Summary Usuarios seguidos
+// @Description Lista de usuarios a los que sigue el usuario, del más reciente al más antiguo. Para paginar se pasa en before_id el id del último recibido. Con token se ocultan los usuarios bloqueados o silenciados; sin token se devuelve la vista pública
+// @Tags users
+// @Produce json
+// @Param Authorization header string false "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Param limit query int false "Número máximo de usuarios (por defecto 20, máximo 100)"
+// @Param before_id query int false "Devolver solo los anteriores a este id"
+// @Success 200 {object} object{following=[]object{id=integer,username=string,avatar_url=string,followed_at=string},followers_count=integer,following_count=integer}
+// @Failure 400 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /users/{username}/following [get]
+func ListFollowing(db *gorm.DB) gin.HandlerFunc {
+	return listFollows(db, false)
+}
+
+// @Summary Publicar un anuncio
+// @Description Publica un anuncio que aparece en el feed de los seguidores del autor
+// @Tags users
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param title formData string true "Título (máximo 255 caracteres)"
+// @Param message formData string true "Texto del anuncio (máximo 2000 caracteres)"
+// @Success 201 {object} object{message=string,id=integer}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string,code=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/announcements [post]
+func PostAnnouncement(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		title := strings.TrimSpace(c.PostForm("title"))
+		text := strings.TrimSpace(c.PostForm("message"))
+		if title == "" || text == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El título y el texto del anuncio son obligatorios"})
+			return
+		}
+		if len(title) > 255 || len(text) > 2000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El título no puede superar los 255 caracteres ni el texto los 2000"})
+			return
+		}
+
+		data, _ := json.Marshal(gin.H{"title": title, "message": text})
+		event := models.SystemEvent{
+			EventType: models.EventAuthorAnnouncement,
+			UserEmail: &user.Email,
+			Data:      data,
+			CreatedAt: time.Now(),
+		}
+		if err := db.Create(&event).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al publicar el anuncio"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Anuncio publicado", "id": event.ID})
+	}
+}
+
+// @Summary Feed de actividad
+// @Description Novelas, capítulos y anuncios de los autores que sigue el usuario, sin los silenciados, del más reciente al más antiguo. Para paginar se pasa en before_id el id del último recibido
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param type query string false "Solo un tipo de actividad (novel_published, chapter_published, author_announcement)"
+// @Param limit query int false "Número máximo de elementos (por defecto 20, máximo 100)"
+// @Param before_id query int false "Devolver solo los anteriores a este id"
+// @Success 200 {object} object{items=[]object{id=integer,type=string,author=object{username=string,avatar_url=string},novel_id=integer,chapter_id=integer,data=object,created_at=string}}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/feed [get]
+func GetFeed(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		limit, beforeID, message := parsePageParams(c, maxFeedPage)
+		if message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+
+		types := models.FeedEventTypes
+		if value := c.Query("type"); value != "" {
+			if !slices.Contains(models.FeedEventTypes, value) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "type inválido. Valores permitidos: " + strings.Join(models.FeedEventTypes, ", ")})
+				return
+			}
+			types = []string{value}
+		}
+
+		// La actividad se guarda una sola vez por autor y se reparte al leer: publicar no cuesta
+		// más por tener muchos seguidores y el índice (user_email, id) resuelve cada autor seguido
+		followed := db.Table("user_follows f").
+			Select("f.followed_email").
+			Joins("JOIN users u ON u.email = f.followed_email AND u.deleted_at IS NULL").
+			Where("f.follower_email = ? AND u.status NOT IN ?", user.Email, hiddenUserStatuses)
+		query := db.Where("event_type IN ? AND user_email IN (?)", types, followed).
+			Scopes(hideBlockedUsers(user.Email, "user_email"))
+		if beforeID > 0 {
+			query = query.Where("id < ?", beforeID)
+		}
+
+		var events []models.SystemEvent
+		if err := query.Order("id DESC").Limit(limit).Find(&events).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el feed"})
+			return
+		}
+
+		// Autores de la página, en una sola consulta
+		var emails []string
+		for _, event := range events {
+			if event.UserEmail != nil && !slices.Contains(emails, *event.UserEmail) {
+				emails = append(emails, *event.UserEmail)
+			}
+		}
+		authors := make(map[string]gin.H, len(emails))
+		if len(emails) > 0 {
+			var users []models.User
+			if err := db.Where("email IN ?", emails).Find(&users).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el feed"})
+				return
+			}
+			for _, author := range users {
+				info := gin.H{"username": author.ProfileUsername}
+				if author.AvatarURL != nil {
+					info["avatar_url"] = *author.AvatarURL
+				}
+				authors[author.Email] = info
+			}
+		}
+
+		items := make([]gin.H, 0, len(events))
+		for _, event := range events {
+			author, ok := authors[*event.UserEmail]
+			if !ok {
+				continue
+			}
+			item := gin.H{
+				"id":         event.ID,
+				"type":       event.EventType,
+				"author":     author,
+				"created_at": event.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			}
+			if event.NovelID != nil {
+				item["novel_id"] = *event.NovelID
+			}
+			if event.ChapterID != nil {
+				item["chapter_id"] = *event.ChapterID
+			}
+			if len(event.Data) > 0 {
+				item["data"] = event.Data
+			}
+			items = append(items, item)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"NovelUzu/constants/auth"
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary Suplantar a un usuario
+// @Description Abre una sesión de soporte como el usuario indicado. El token lleva al administrador en el claim act, caduca sin posibilidad de refresco, no permite gestionar la cuenta (contraseña, correo, 2FA, tokens, eliminación) y cada petición queda registrada en system_events
+// @Tags admin
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Param reason formData string true "Motivo de la suplantación (queda registrado)"
+// @Param duration formData string false "Duración (p. ej. 15m). Por defecto IMPERSONATION_TTL, máximo 2h"
+// @Success 201 {object} object{message=string,token=string,expires_at=string,session_id=integer,user=object{username=string,email=string}}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/users/{username}/impersonate [post]
+func StartImpersonation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin := middleware.CurrentUser(c)
+
+		reason := strings.TrimSpace(c.PostForm("reason"))
+		if reason == "" || len(reason) > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El motivo es obligatorio y no puede superar los 500 caracteres"})
+			return
+		}
+
+		ttl := utils.DurationFromEnv("IMPERSONATION_TTL", auth.DefaultImpersonationTTL)
+		if value := c.PostForm("duration"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 || d > auth.MaxImpersonationTTL {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "duration debe ser una duración positiva de como máximo 2h"})
+				return
+			}
+			ttl = d
+		}
+		if ttl > auth.MaxImpersonationTTL {
+			ttl = auth.MaxImpersonationTTL
+		}
+
+		var target models.User
+		if err := db.Where("username = ?", c.Param("username")).First(&target).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+			return
+		}
+
+		if target.Email == admin.Email {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No puedes suplantarte a ti mismo"})
+			return
+		}
+		// Suplantar a otro administrador permitiría saltarse su 2FA y heredar sus permisos
+		if target.Role == models.UserRoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No se puede suplantar a otro administrador"})
+			return
+		}
+
+		statusErr, err := middleware.CheckAccountStatus(db, &target)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el estado de la cuenta"})
+			return
+		}
+		if statusErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No se puede suplantar esta cuenta: " + statusErr.Message})
+			return
+		}
+
+		// La sesión no tiene refresh token utilizable: el valor guardado es el hash de un secreto
+		// aleatorio que no se entrega a nadie
+		placeholder, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al iniciar la suplantación"})
+			return
+		}
+		ip := c.ClientIP()
+		userAgent := c.Request.UserAgent()
+		now := time.Now()
+		session := models.UserSession{
+			UserEmail:         target.Email,
+			SessionToken:      utils.HashToken(placeholder),
+			IPAddress:         &ip,
+			UserAgent:         &userAgent,
+			ExpiresAt:         now.Add(ttl),
+			LastSeenAt:        &now,
+			ImpersonatorEmail: &admin.Email,
+			CreatedAt:         now,
+		}
+		if err := db.Create(&session).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al iniciar la suplantación"})
+			return
+		}
+
+		token, err := middleware.GenerateImpersonationToken(target.Email, session.ID, admin.Email, session.ExpiresAt)
+		if err != nil {
+			middleware.RevokeSession(db, session.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el JWT"})
+			return
+		}
+
+		// Sin registro de auditoría no hay suplantación
+		if err := middleware.RecordSystemEvent(db, c, models.EventImpersonationStarted, target.Email, gin.H{
+			"impersonator": admin.Email,
+			"session_id":   session.ID,
+			"reason":       reason,
+			"expires_at":   session.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		}); err != nil {
+			fmt.Printf("Error al registrar la suplantación de %s por %s: %v\n", target.Email, admin.Email, err)
+			middleware.RevokeSession(db, session.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al iniciar la suplantación"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message":    "Suplantación iniciada. Cierra la sesión con /auth/logout al terminar",
+			"token":      token,
+			"expires_at": session.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+			"session_id": session.ID,
+			"user": gin.H{
+				"username": target.ProfileUsername,
+				"email":    target.Email,
+			},
+		})
+	}
+}
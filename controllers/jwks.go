@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"NovelUzu/middleware"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Claves públicas de firma (JWKS)
+// @Description Devuelve las claves públicas con las que se verifican los JWT emitidos por la API. El kid de la cabecera del token indica qué clave usar
+// @Tags auth
+// @Produce json
+// @Success 200 {object} object{keys=[]object{kty=string,kid=string,use=string,alg=string,n=string,e=string,crv=string,x=string}}
+// @Failure 500 {object} object{error=string}
+// @Router /.well-known/jwks.json [get]
+func JWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := middleware.SigningKeys()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cargar las claves de firma"})
+			return
+		}
+
+		// Los verificadores pueden cachear el documento; tras una rotación la clave antigua sigue publicada
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keys.JWKS())
+	}
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils/realtime"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxNotificationsPage es el máximo de notificaciones devueltas por página
+const maxNotificationsPage = 100
+
+// SocketAuthenticator autentica los handshakes del gateway de Socket.IO con el token de acceso
+// de la sesión. Mientras el socket sigue abierto se revalidan periódicamente la sesión y el estado
+// de la cuenta
+func SocketAuthenticator(db *gorm.DB) realtime.Authenticator {
+	return func(authData map[string]interface{}) (*realtime.Session, error) {
+		user, sessionID, err := middleware.AuthenticateSocket(db, authData)
+		if err != nil {
+			return nil, err
+		}
+
+		email := user.Email
+		return &realtime.Session{
+			Email: email,
+			Active: func() bool {
+				active, err := socketSessionActive(db, sessionID, email)
+				if err != nil {
+					// Ante la duda se corta la conexión; el cliente puede volver a conectarse
+					fmt.Printf("Error al revalidar la sesión %d: %v\n", sessionID, err)
+					return false
+				}
+				return active
+			},
+		}, nil
+	}
+}
+
+// socketSessionActive indica si la sesión sigue sin revocar y la cuenta puede usarse (no está
+// baneada, suspendida ni inactiva)
+func socketSessionActive(db *gorm.DB, sessionID uint, email string) (bool, error) {
+	active, err := middleware.SessionActive(db, sessionID, email)
+	if err != nil || !active {
+		return false, err
+	}
+
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		return false, err
+	}
+	statusErr, err := middleware.CheckAccountStatus(db, &user)
+	if err != nil {
+		return false, err
+	}
+	return statusErr == nil, nil
+}
+
+// notificationInfo es la representación de una notificación en la API y en los eventos en directo
+func notificationInfo(notification *models.Notification) gin.H {
+	info := gin.H{
+		"id":         notification.ID,
+		"type":       string(notification.Type),
+		"title":      notification.Title,
+		"message":    notification.Message,
+		"is_read":    notification.IsRead,
+		"created_at": notification.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if len(notification.Data) > 0 {
+		info["data"] = notification.Data
+	}
+	return info
+}
+
+// Notify guarda una notificación para el usuario y la envía a sus conexiones abiertas.
+// data puede ser nil o cualquier valor serializable a JSON (ids de novela, capítulo...)
+func Notify(db *gorm.DB, hub *realtime.Hub, email string, kind models.NotificationType, title, message string, data any) (*models.Notification, error) {
+	notification := models.Notification{
+		UserEmail: email,
+		Type:      kind,
+		Title:     title,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		notification.Data = raw
+	}
+
+	if err := db.Create(&notification).Error; err != nil {
+		return nil, err
+	}
+
+	hub.NotifyUser(email, notificationInfo(&notification))
+	return &notification, nil
+}
+
+// suppressedFrom indica si los avisos que provoca actorEmail no deben llegar a email: porque este
+// lo ha bloqueado o silenciado, o porque actorEmail lo ha bloqueado a él
+func suppressedFrom(db *gorm.DB, actorEmail, email string) (bool, error) {
+	hidden, err := isHiddenBy(db, email, actorEmail)
+	if err != nil {
+		return false, err
+	}
+	blocked, err := isBlockedBy(db, actorEmail, email)
+	if err != nil {
+		return false, err
+	}
+	return hidden || blocked, nil
+}
+
+// NotifyFrom es Notify para avisos provocados por otro usuario (respuestas, comentarios...): no
+// se envía nada si el destinatario ha bloqueado o silenciado a actorEmail, ni si actorEmail lo
+// ha bloqueado a él. En ese caso devuelve nil sin error
+func NotifyFrom(db *gorm.DB, hub *realtime.Hub, actorEmail, email string, kind models.NotificationType, title, message string, data any) (*models.Notification, error) {
+	suppressed, err := suppressedFrom(db, actorEmail, email)
+	if err != nil || suppressed {
+		return nil, err
+	}
+	return Notify(db, hub, email, kind, title, message, data)
+}
+
+// PublishCommentReply envía en directo al autor de un comentario la respuesta de actorEmail,
+// con los mismos filtros de bloqueo y silencio que NotifyFrom. Devuelve las conexiones avisadas
+func PublishCommentReply(db *gorm.DB, hub *realtime.Hub, actorEmail, email string, reply any) (int, error) {
+	suppressed, err := suppressedFrom(db, actorEmail, email)
+	if err != nil || suppressed {
+		return 0, err
+	}
+	return hub.PublishCommentReply(email, reply), nil
+}
+
+// @Summary Listar notificaciones
+// @Description Devuelve las notificaciones del usuario, de la más reciente a la más antigua. Para paginar se pasa en before_id el id de la última recibida
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param unread query bool false "Solo las no leídas"
+// @Param limit query int false "Número máximo de notificaciones (por defecto 20, máximo 100)"
+// @Param before_id query int false "Devolver solo notificaciones anteriores a este id"
+// @Success 200 {object} object{notifications=[]object{id=integer,type=string,title=string,message=string,data=object,is_read=boolean,created_at=string},unread_count=integer}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/notifications [get]
+func ListNotifications(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		limit := 20
+		if value := c.Query("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxNotificationsPage {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit debe estar entre 1 y 100"})
+				return
+			}
+			limit = n
+		}
+
+		query := db.Where("user_email = ?", user.Email)
+		if value := c.Query("before_id"); value != "" {
+			beforeID, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "before_id inválido"})
+				return
+			}
+			query = query.Where("id < ?", beforeID)
+		}
+		if c.Query("unread") == "true" {
+			query = query.Where("is_read = ?", false)
+		}
+
+		var notifications []models.Notification
+		if err := query.Order("id DESC").Limit(limit).Find(&notifications).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las notificaciones"})
+			return
+		}
+
+		var unread int64
+		if err := db.Model(&models.Notification{}).
+			Where("user_email = ? AND is_read = ?", user.Email, false).
+			Count(&unread).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las notificaciones"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(notifications))
+		for i := range notifications {
+			result = append(result, notificationInfo(&notifications[i]))
+		}
+
+		c.JSON(http.StatusOK, gin.H{"notifications": result, "unread_count": unread})
+	}
+}
+
+// @Summary Marcar una notificación como leída
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param id path int true "Identificador de la notificación"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/notifications/{id}/read [put]
+func MarkNotificationRead(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Identificador de notificación inválido"})
+			return
+		}
+
+		result := db.Model(&models.Notification{}).
+			Where("id = ? AND user_email = ?", id, middleware.CurrentUser(c).Email).
+			Update("is_read", true)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar la notificación"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notificación no encontrada"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Notificación marcada como leída"})
+	}
+}
+
+// @Summary Marcar todas las notificaciones como leídas
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{message=string,updated=integer}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/notifications/read-all [put]
+func MarkAllNotificationsRead(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Model(&models.Notification{}).
+			Where("user_email = ? AND is_read = ?", middleware.CurrentUser(c).Email, false).
+			Update("is_read", true)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar las notificaciones"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Notificaciones marcadas como leídas", "updated": result.RowsAffected})
+	}
+}
@@ -0,0 +1,543 @@
+package controllers
+
+import (
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/oidc"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Claves de la sesión (cookie) en las que se guarda el flujo OIDC en curso
+const (
+	oidcSessionProvider  = "oidc_provider"
+	oidcSessionState     = "oidc_state"
+	oidcSessionNonce     = "oidc_nonce"
+	oidcSessionVerifier  = "oidc_verifier"
+	oidcSessionLinkEmail = "oidc_link_email"
+	oidcSessionStartedAt = "oidc_started_at"
+)
+
+// oidcFlowTTL es el tiempo máximo entre la redirección al proveedor y la vuelta al callback
+const oidcFlowTTL = 10 * time.Minute
+
+// oidcFrontendPath es la página del frontend que recibe el resultado del flujo en el fragmento de la URL
+const oidcFrontendPath = "/oauth/callback"
+
+// usernameInvalidChars elimina lo que no queremos en un nombre de usuario generado automáticamente
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// redirectOIDCResult vuelve al frontend con el resultado en el fragmento, que el navegador no envía a ningún servidor
+func redirectOIDCResult(c *gin.Context, values url.Values) {
+	c.Redirect(http.StatusFound, frontendURL()+oidcFrontendPath+"#"+values.Encode())
+}
+
+// redirectOIDCError vuelve al frontend con un mensaje de error
+func redirectOIDCError(c *gin.Context, message string) {
+	redirectOIDCResult(c, url.Values{"error": {message}})
+}
+
+// publicBaseURL devuelve la URL pública de esta API (PUBLIC_BASE_URL) sin barra final. No se
+// deduce de la petición porque Host y X-Forwarded-Proto los controla el cliente
+func publicBaseURL() string {
+	base := os.Getenv("PUBLIC_BASE_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimRight(base, "/")
+}
+
+// @Summary Proveedores OIDC disponibles
+// @Description Lista los proveedores externos (OpenID Connect) con los que se puede iniciar sesión
+// @Tags auth
+// @Produce json
+// @Success 200 {object} object{providers=[]string}
+// @Router /auth/oidc/providers [get]
+func OIDCProviders(providers map[string]*oidc.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		names := make([]string, 0, len(providers))
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.JSON(http.StatusOK, gin.H{"providers": names})
+	}
+}
+
+// @Summary Iniciar sesión con un proveedor OIDC
+// @Description Redirige al proveedor externo (authorization code + PKCE). Con link_ticket el flujo vincula la cuenta externa al usuario del ticket en lugar de iniciar sesión
+// @Tags auth
+// @Param provider path string true "Nombre del proveedor"
+// @Param link_ticket query string false "Ticket devuelto por POST /user/identities/{provider}"
+// @Success 302
+// @Failure 404 {object} object{error=string}
+// @Router /auth/oidc/{provider}/login [get]
+func OIDCLogin(providers map[string]*oidc.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Proveedor no soportado"})
+			return
+		}
+
+		linkEmail := ""
+		if ticket := c.Query("link_ticket"); ticket != "" {
+			email, err := middleware.ParseOIDCLinkTicket(ticket)
+			if err != nil {
+				redirectOIDCError(c, "El enlace de vinculación no es válido o ha caducado")
+				return
+			}
+			linkEmail = email
+		}
+
+		state, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			redirectOIDCError(c, "Error al iniciar sesión con el proveedor")
+			return
+		}
+		nonce, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			redirectOIDCError(c, "Error al iniciar sesión con el proveedor")
+			return
+		}
+		verifier, challenge, err := oidc.NewPKCE()
+		if err != nil {
+			redirectOIDCError(c, "Error al iniciar sesión con el proveedor")
+			return
+		}
+
+		authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+		if err != nil {
+			fmt.Printf("Error al contactar con el proveedor OIDC %s: %v\n", provider.Name, err)
+			redirectOIDCError(c, "El proveedor no está disponible en este momento")
+			return
+		}
+
+		session := sessions.Default(c)
+		session.Set(oidcSessionProvider, provider.Name)
+		session.Set(oidcSessionState, state)
+		session.Set(oidcSessionNonce, nonce)
+		session.Set(oidcSessionVerifier, verifier)
+		session.Set(oidcSessionLinkEmail, linkEmail)
+		session.Set(oidcSessionStartedAt, time.Now().Unix())
+		if err := session.Save(); err != nil {
+			redirectOIDCError(c, "Error al iniciar sesión con el proveedor")
+			return
+		}
+
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// @Summary Callback del proveedor OIDC
+// @Description Recibe la respuesta del proveedor, valida state, nonce e ID token y redirige al frontend (/oauth/callback) con el resultado en el fragmento: token, refresh_token y expires_at; challenge_token si el usuario tiene 2FA; linked al vincular; o error
+// @Tags auth
+// @Param provider path string true "Nombre del proveedor"
+// @Param code query string false "Código de autorización"
+// @Param state query string false "Valor state del flujo"
+// @Success 302
+// @Failure 404 {object} object{error=string}
+// @Router /auth/oidc/{provider}/callback [get]
+func OIDCCallback(db *gorm.DB, providers map[string]*oidc.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Proveedor no soportado"})
+			return
+		}
+
+		// El flujo guardado es de un solo uso: se borra antes de validar nada
+		session := sessions.Default(c)
+		savedProvider, _ := session.Get(oidcSessionProvider).(string)
+		savedState, _ := session.Get(oidcSessionState).(string)
+		nonce, _ := session.Get(oidcSessionNonce).(string)
+		verifier, _ := session.Get(oidcSessionVerifier).(string)
+		linkEmail, _ := session.Get(oidcSessionLinkEmail).(string)
+		startedAt, _ := session.Get(oidcSessionStartedAt).(int64)
+		for _, key := range []string{oidcSessionProvider, oidcSessionState, oidcSessionNonce, oidcSessionVerifier, oidcSessionLinkEmail, oidcSessionStartedAt} {
+			session.Delete(key)
+		}
+		session.Save()
+
+		if c.Query("error") != "" {
+			redirectOIDCError(c, "Se ha cancelado el inicio de sesión con el proveedor")
+			return
+		}
+
+		state := c.Query("state")
+		if savedState == "" || savedProvider != provider.Name ||
+			subtle.ConstantTimeCompare([]byte(state), []byte(savedState)) != 1 ||
+			time.Since(time.Unix(startedAt, 0)) > oidcFlowTTL {
+			redirectOIDCError(c, "La solicitud de inicio de sesión no es válida o ha caducado")
+			return
+		}
+
+		code := c.Query("code")
+		if code == "" {
+			redirectOIDCError(c, "La respuesta del proveedor no incluye el código de autorización")
+			return
+		}
+
+		ctx := c.Request.Context()
+		tokens, err := provider.Exchange(ctx, code, verifier)
+		if err != nil {
+			fmt.Printf("Error al canjear el código OIDC de %s: %v\n", provider.Name, err)
+			redirectOIDCError(c, "No se ha podido completar el inicio de sesión con el proveedor")
+			return
+		}
+		identity, err := provider.VerifyIDToken(ctx, tokens.IDToken, nonce)
+		if err != nil {
+			fmt.Printf("Error al verificar el ID token de %s: %v\n", provider.Name, err)
+			redirectOIDCError(c, "No se ha podido completar el inicio de sesión con el proveedor")
+			return
+		}
+
+		// Vinculación desde el perfil de un usuario ya autenticado
+		if linkEmail != "" {
+			if msg, err := linkExternalIdentity(db, linkEmail, provider.Name, identity); err != nil {
+				fmt.Printf("Error al vincular la identidad OIDC: %v\n", err)
+				redirectOIDCError(c, "Error al vincular la cuenta")
+			} else if msg != "" {
+				redirectOIDCError(c, msg)
+			} else {
+				redirectOIDCResult(c, url.Values{"linked": {provider.Name}})
+			}
+			return
+		}
+
+		user, msg, err := resolveExternalUser(db, provider.Name, identity)
+		if err != nil {
+			fmt.Printf("Error al resolver el usuario OIDC: %v\n", err)
+			redirectOIDCError(c, "Error al iniciar sesión con el proveedor")
+			return
+		}
+		if msg != "" {
+			redirectOIDCError(c, msg)
+			return
+		}
+
+		statusErr, err := middleware.CheckAccountStatus(db, user)
+		if err != nil {
+			redirectOIDCError(c, "Error al verificar el estado de la cuenta")
+			return
+		}
+		if statusErr != nil {
+			redirectOIDCResult(c, url.Values{"error": {statusErr.Message}, "code": {statusErr.Code}})
+			return
+		}
+
+		// El proveedor sustituye a la contraseña, no a la verificación en dos pasos
+		if user.TOTPEnabled {
+			challenge, expiresAt, err := middleware.GenerateTwoFactorChallenge(user.Email)
+			if err != nil {
+				redirectOIDCError(c, "Error al generar el JWT")
+				return
+			}
+			redirectOIDCResult(c, url.Values{
+				"two_factor_required": {"true"},
+				"challenge_token":     {challenge},
+				"expires_at":          {expiresAt.Format("2006-01-02T15:04:05Z07:00")},
+			})
+			return
+		}
+
+		pair, err := startSession(db, c, user.Email)
+		if err != nil {
+			redirectOIDCError(c, "Error al generar el JWT")
+			return
+		}
+
+		deletionCancelled := cancelScheduledDeletion(db, user)
+
+		now := time.Now()
+		user.LastLogin = &now
+		db.Save(user)
+
+		result := url.Values{
+			"token":         {pair.AccessToken},
+			"refresh_token": {pair.RefreshToken},
+			"expires_at":    {pair.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")},
+		}
+		if middleware.TwoFactorRequired(user) && !user.TOTPEnabled {
+			result.Set("two_factor_setup_required", "true")
+		}
+		if deletionCancelled {
+			result.Set("deletion_cancelled", "true")
+		}
+		redirectOIDCResult(c, result)
+	}
+}
+
+// resolveExternalUser devuelve el usuario asociado a una identidad externa, vinculándola o creando
+// la cuenta si es la primera vez. Devuelve un mensaje para el usuario si no se puede iniciar sesión
+func resolveExternalUser(db *gorm.DB, provider string, identity *oidc.Identity) (*models.User, string, error) {
+	var link models.ExternalIdentity
+	err := db.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&link).Error
+	if err == nil {
+		var user models.User
+		if err := db.Where("email = ?", link.UserEmail).First(&user).Error; err != nil {
+			return nil, "", err
+		}
+		return &user, "", nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, "", err
+	}
+
+	if identity.Email == "" {
+		return nil, "El proveedor no ha facilitado un correo electrónico", nil
+	}
+	if !identity.EmailVerified {
+		return nil, "El proveedor no ha verificado tu correo electrónico", nil
+	}
+
+	var user models.User
+	err = db.Where("email = ?", identity.Email).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, "", err
+	}
+
+	if err == nil {
+		// Solo se vincula automáticamente si ambos lados han verificado el correo; si no, alguien
+		// podría haber registrado de antemano una cuenta con el correo de otra persona
+		if !user.EmailVerified {
+			return nil, "Ya existe una cuenta con este correo. Inicia sesión con tu contraseña y vincula el proveedor desde tu perfil", nil
+		}
+		if msg, err := linkExternalIdentity(db, user.Email, provider, identity); err != nil || msg != "" {
+			return nil, msg, err
+		}
+		return &user, "", nil
+	}
+
+	username, err := availableUsername(db, identity)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Las cuentas creadas desde un proveedor no tienen contraseña hasta que el usuario la establece
+	// mediante la recuperación de contraseña
+	user = models.User{
+		Email:           identity.Email,
+		ProfileUsername: username,
+		PasswordHash:    "",
+		Role:            models.UserRoleUsuario,
+		Status:          models.UserStatusActivo,
+		EmailVerified:   true,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ExternalIdentity{
+			UserEmail: user.Email,
+			Provider:  provider,
+			Subject:   identity.Subject,
+			Email:     &identity.Email,
+			CreatedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &user, "", nil
+}
+
+// linkExternalIdentity vincula la identidad externa al usuario. Devuelve un mensaje para el
+// usuario si la identidad ya pertenece a otra cuenta o si ya tiene otra cuenta de ese proveedor
+func linkExternalIdentity(db *gorm.DB, email, provider string, identity *oidc.Identity) (string, error) {
+	var existing models.ExternalIdentity
+	err := db.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&existing).Error
+	if err == nil {
+		if existing.UserEmail == email {
+			return "", nil
+		}
+		return "Esta cuenta del proveedor ya está vinculada a otro usuario", nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return "", err
+	}
+
+	var count int64
+	if err := db.Model(&models.ExternalIdentity{}).Where("user_email = ? AND provider = ?", email, provider).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "Ya tienes otra cuenta de este proveedor vinculada. Desvincúlala antes de vincular una nueva", nil
+	}
+
+	link := models.ExternalIdentity{
+		UserEmail: email,
+		Provider:  provider,
+		Subject:   identity.Subject,
+		CreatedAt: time.Now(),
+	}
+	if identity.Email != "" {
+		link.Email = &identity.Email
+	}
+	return "", db.Create(&link).Error
+}
+
+// availableUsername genera un nombre de usuario libre a partir de los datos del proveedor
+func availableUsername(db *gorm.DB, identity *oidc.Identity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if base == "" {
+		base = "usuario"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 10; attempt++ {
+		var count int64
+		if err := db.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%04d", base, n.Int64())
+	}
+	return "", fmt.Errorf("no se ha encontrado un nombre de usuario libre para %q", base)
+}
+
+// @Summary Listar cuentas externas vinculadas
+// @Description Devuelve las cuentas de proveedores OIDC vinculadas al usuario y los proveedores disponibles
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{identities=[]object{provider=string,email=string,created_at=string},providers=[]string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/identities [get]
+func ListExternalIdentities(db *gorm.DB, providers map[string]*oidc.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		var links []models.ExternalIdentity
+		if err := db.Where("user_email = ?", user.Email).Order("created_at").Find(&links).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las cuentas vinculadas"})
+			return
+		}
+
+		identities := make([]gin.H, 0, len(links))
+		for _, link := range links {
+			item := gin.H{
+				"provider":   link.Provider,
+				"created_at": link.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			}
+			if link.Email != nil {
+				item["email"] = *link.Email
+			}
+			identities = append(identities, item)
+		}
+
+		names := make([]string, 0, len(providers))
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		c.JSON(http.StatusOK, gin.H{"identities": identities, "providers": names})
+	}
+}
+
+// @Summary Vincular una cuenta externa
+// @Description Devuelve la URL a la que el navegador debe ir para vincular una cuenta del proveedor. La URL caduca en pocos minutos
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param provider path string true "Nombre del proveedor"
+// @Success 200 {object} object{authorization_url=string,expires_at=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/identities/{provider} [post]
+func LinkExternalIdentity(providers map[string]*oidc.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("provider")
+		if _, ok := providers[name]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Proveedor no soportado"})
+			return
+		}
+
+		ticket, expiresAt, err := middleware.GenerateOIDCLinkTicket(middleware.CurrentUser(c).Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el JWT"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"authorization_url": fmt.Sprintf("%s/auth/oidc/%s/login?link_ticket=%s", publicBaseURL(), url.PathEscape(name), url.QueryEscape(ticket)),
+			"expires_at":        expiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+}
+
+// @Summary Desvincular una cuenta externa
+// @Description Elimina la vinculación con el proveedor. No se permite si es el único método de inicio de sesión del usuario
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param provider path string true "Nombre del proveedor"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/identities/{provider} [delete]
+func UnlinkExternalIdentity(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		var link models.ExternalIdentity
+		if err := db.Where("user_email = ? AND provider = ?", user.Email, c.Param("provider")).First(&link).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No tienes ninguna cuenta vinculada con ese proveedor"})
+			return
+		}
+
+		// Sin contraseña, la última identidad vinculada es la única forma de entrar en la cuenta
+		if user.PasswordHash == "" {
+			var count int64
+			if err := db.Model(&models.ExternalIdentity{}).Where("user_email = ?", user.Email).Count(&count).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al desvincular la cuenta"})
+				return
+			}
+			if count <= 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "No puedes desvincular tu único método de inicio de sesión. Establece antes una contraseña mediante la recuperación de contraseña"})
+				return
+			}
+		}
+
+		if err := db.Delete(&link).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al desvincular la cuenta"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Cuenta desvinculada exitosamente"})
+	}
+}
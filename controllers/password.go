@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"NovelUzu/constants/auth"
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/mailer"
+	"NovelUzu/utils/passwords"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CodeWeakPassword acompaña a los errores de la política de contraseñas
+const CodeWeakPassword = "weak_password"
+
+// checkNewPassword aplica la política de contraseñas (PASSWORD_*). Si no se cumple responde 400
+// con los requisitos incumplidos y la puntuación, y devuelve false
+func checkNewPassword(c *gin.Context, password string, userInputs ...string) bool {
+	result, err := passwords.PolicyFromEnv().Check(password, userInputs...)
+	if err != nil {
+		// Un fallo leyendo la lista de contraseñas filtradas no debe impedir registrarse
+		fmt.Printf("Error al comprobar la lista de contraseñas filtradas: %v\n", err)
+	}
+	if result.Valid() {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "La contraseña no cumple la política de seguridad",
+		"code":    CodeWeakPassword,
+		"details": result,
+	})
+	return false
+}
+
+// @Summary Política de contraseñas
+// @Description Devuelve los requisitos que deben cumplir las contraseñas nuevas, para mostrarlos en los formularios
+// @Tags auth
+// @Produce json
+// @Success 200 {object} object{min_length=integer,max_length=integer,require_lowercase=boolean,require_uppercase=boolean,require_digit=boolean,require_symbol=boolean,min_score=integer,check_breached=boolean}
+// @Router /password/policy [get]
+func PasswordPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, passwords.PolicyFromEnv())
+	}
+}
+
+// hashPassword genera el hash (Argon2id en formato PHC) que se guarda en users.password_hash
+func hashPassword(password string) (string, error) {
+	return passwords.Hash(password)
+}
+
+// @Summary Solicitar restablecimiento de contraseña
+// @Description Envía un enlace para restablecer la contraseña si el correo pertenece a una cuenta. La respuesta es la misma exista o no la cuenta
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param email formData string true "Correo electrónico de la cuenta"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Router /password/forgot [post]
+func ForgotPassword(db *gorm.DB, mail mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := strings.TrimSpace(c.PostForm("email"))
+		if email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parametro email es obligatorio"})
+			return
+		}
+
+		// El trabajo se hace en segundo plano para que el tiempo de respuesta no revele si la cuenta existe
+		go func() {
+			if err := sendPasswordReset(db, mail, email); err != nil {
+				fmt.Printf("Error al enviar el correo de restablecimiento: %v\n", err)
+			}
+		}()
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Si el correo pertenece a una cuenta, recibirás un enlace para restablecer la contraseña",
+		})
+	}
+}
+
+// sendPasswordReset genera un token de un solo uso, guarda su hash y lo envía por correo.
+// No hace nada si no existe ninguna cuenta con ese email
+func sendPasswordReset(db *gorm.DB, mail mailer.Mailer, email string) error {
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(utils.DurationFromEnv("PASSWORD_RESET_TTL", auth.DefaultPasswordResetTTL))
+	if err := db.Model(&user).Updates(map[string]interface{}{
+		"password_reset_token":   utils.HashToken(token),
+		"password_reset_expires": expires,
+	}).Error; err != nil {
+		return err
+	}
+
+	return mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Restablece tu contraseña de NovelUzu",
+		Body: fmt.Sprintf("Hola %s,\n\nHemos recibido una solicitud para restablecer tu contraseña. Para elegir una nueva abre el siguiente enlace:\n\n%s\n\n"+
+			"El enlace solo se puede usar una vez y caduca el %s. Si no has sido tú puedes ignorar este mensaje.\n",
+			user.ProfileUsername, frontendLink("/reset-password", token), expires.Format("02/01/2006 15:04")),
+	})
+}
+
+// @Summary Restablecer contraseña
+// @Description Cambia la contraseña usando el token recibido por correo, cierra todas las sesiones abiertas y revoca los tokens de acceso personal
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token recibido por correo"
+// @Param new_password formData string true "Nueva contraseña"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string,code=string,details=object{score=integer,min_score=integer,violations=[]object{code=string,message=string}}}
+// @Failure 500 {object} object{error=string}
+// @Router /password/reset [post]
+func ResetPassword(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(c.PostForm("token"))
+		newPassword := c.PostForm("new_password")
+
+		if token == "" || newPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token y new_password son obligatorios"})
+			return
+		}
+
+		var user models.User
+		if err := db.Where("password_reset_token = ?", utils.HashToken(token)).First(&user).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Token de restablecimiento inválido"})
+			return
+		}
+
+		if user.PasswordResetExpires == nil || time.Now().After(*user.PasswordResetExpires) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El token de restablecimiento ha caducado"})
+			return
+		}
+
+		if !checkNewPassword(c, newPassword, user.ProfileUsername, user.Email) {
+			return
+		}
+
+		hashedPassword, err := hashPassword(newPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al procesar la nueva contraseña"})
+			return
+		}
+
+		// El token se consume en la misma actualización, condicionado a que siga siendo el vigente
+		result := db.Model(&models.User{}).
+			Where("email = ? AND password_reset_token = ?", user.Email, utils.HashToken(token)).
+			Updates(map[string]interface{}{
+				"password_hash":          hashedPassword,
+				"password_reset_token":   nil,
+				"password_reset_expires": nil,
+				// Quien recibe el enlace demuestra ser dueño del correo
+				"email_verified": true,
+				"updated_at":     time.Now(),
+			})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar la contraseña"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Token de restablecimiento inválido"})
+			return
+		}
+
+		if err := middleware.RevokeUserSessions(db, user.Email, 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cerrar las sesiones abiertas"})
+			return
+		}
+		if err := middleware.RevokePersonalTokens(db, user.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al revocar los tokens de acceso personal"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Contraseña restablecida exitosamente"})
+	}
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"NovelUzu/constants/auth"
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// parseScopes admite los ámbitos repetidos en el formulario o separados por comas/espacios.
+// Devuelve el ámbito desconocido si lo hay
+func parseScopes(values []string) ([]string, string) {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, value := range values {
+		for _, scope := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if _, ok := auth.TokenScopes[scope]; !ok {
+				return nil, scope
+			}
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes, ""
+}
+
+// personalTokenInfo es la representación pública de un token (nunca incluye el secreto)
+func personalTokenInfo(token *models.PersonalAccessToken) gin.H {
+	info := gin.H{
+		"id":         token.ID,
+		"name":       token.Name,
+		"prefix":     token.TokenPrefix,
+		"scopes":     token.ScopeList(),
+		"created_at": token.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if token.ExpiresAt != nil {
+		info["expires_at"] = token.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if token.LastUsedAt != nil {
+		info["last_used_at"] = token.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if token.LastUsedIP != nil {
+		info["last_used_ip"] = *token.LastUsedIP
+	}
+	return info
+}
+
+// @Summary Listar tokens de acceso personal
+// @Description Devuelve los tokens vigentes del usuario (sin el secreto) y los ámbitos que se pueden conceder
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{tokens=[]object{id=integer,name=string,prefix=string,scopes=[]string,expires_at=string,last_used_at=string,last_used_ip=string,created_at=string},scopes=object}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string,code=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/tokens [get]
+func ListPersonalTokens(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		var tokens []models.PersonalAccessToken
+		if err := db.Where("user_email = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", user.Email, time.Now()).
+			Order("created_at DESC").
+			Find(&tokens).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los tokens"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(tokens))
+		for i := range tokens {
+			result = append(result, personalTokenInfo(&tokens[i]))
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tokens": result, "scopes": auth.TokenScopes})
+	}
+}
+
+// @Summary Crear un token de acceso personal
+// @Description Crea un token con los ámbitos indicados para usar la API desde otras aplicaciones. El token solo se muestra en esta respuesta
+// @Tags user
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param name formData string true "Nombre para reconocer el token"
+// @Param scopes formData []string true "Ámbitos concedidos (p. ej. library:read)" collectionFormat(multi)
+// @Param expires_in_days formData int false "Días de validez (por defecto 90, máximo 365)"
+// @Success 201 {object} object{message=string,token=string,id=integer,name=string,prefix=string,scopes=[]string,expires_at=string,created_at=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string,code=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/tokens [post]
+func CreatePersonalToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		name := strings.TrimSpace(c.PostForm("name"))
+		if name == "" || len(name) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El nombre es obligatorio y no puede superar los 100 caracteres"})
+			return
+		}
+
+		scopes, unknown := parseScopes(c.PostFormArray("scopes"))
+		if unknown != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ámbito desconocido: " + unknown})
+			return
+		}
+		if len(scopes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Debes conceder al menos un ámbito"})
+			return
+		}
+
+		lifetime := auth.DefaultPersonalTokenLifetime
+		if value := c.PostForm("expires_in_days"); value != "" {
+			days, err := strconv.Atoi(value)
+			if err != nil || days < 1 || time.Duration(days)*24*time.Hour > auth.MaxPersonalTokenLifetime {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days debe estar entre 1 y 365"})
+				return
+			}
+			lifetime = time.Duration(days) * 24 * time.Hour
+		}
+
+		var count int64
+		if err := db.Model(&models.PersonalAccessToken{}).
+			Where("user_email = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", user.Email, time.Now()).
+			Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear el token"})
+			return
+		}
+		if count >= auth.MaxPersonalTokensPerUser {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Has alcanzado el número máximo de tokens. Revoca alguno antes de crear otro"})
+			return
+		}
+
+		secret, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear el token"})
+			return
+		}
+		tokenString := auth.PersonalTokenPrefix + secret
+
+		expiresAt := time.Now().Add(lifetime)
+		token := models.PersonalAccessToken{
+			UserEmail:   user.Email,
+			Name:        name,
+			TokenHash:   utils.HashToken(tokenString),
+			TokenPrefix: tokenString[:len(auth.PersonalTokenPrefix)+4],
+			Scopes:      strings.Join(scopes, " "),
+			ExpiresAt:   &expiresAt,
+			CreatedAt:   time.Now(),
+		}
+		if err := db.Create(&token).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear el token"})
+			return
+		}
+
+		response := personalTokenInfo(&token)
+		response["message"] = "Token creado. Guárdalo ahora: no se volverá a mostrar"
+		response["token"] = tokenString
+		c.JSON(http.StatusCreated, response)
+	}
+}
+
+// @Summary Revocar un token de acceso personal
+// @Description Revoca el token indicado; deja de aceptarse inmediatamente
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param id path int true "Identificador del token"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string,code=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/tokens/{id} [delete]
+func RevokePersonalToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Identificador de token inválido"})
+			return
+		}
+
+		result := db.Model(&models.PersonalAccessToken{}).
+			Where("id = ? AND user_email = ? AND revoked_at IS NULL", id, middleware.CurrentUser(c).Email).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al revocar el token"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token no encontrado"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Token revocado exitosamente"})
+	}
+}
@@ -0,0 +1,437 @@
+package controllers
+
+import (
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// privacySetting relaciona una sección del perfil público con su ajuste de privacidad
+type privacySetting struct {
+	Key   string
+	Field func(s *models.UserPrivacySettings) *bool
+}
+
+var privacySettings = []privacySetting{
+	{Key: "bio", Field: func(s *models.UserPrivacySettings) *bool { return &s.ShowBio }},
+	{Key: "country", Field: func(s *models.UserPrivacySettings) *bool { return &s.ShowCountry }},
+	{Key: "join_date", Field: func(s *models.UserPrivacySettings) *bool { return &s.ShowJoinDate }},
+	{Key: "novels", Field: func(s *models.UserPrivacySettings) *bool { return &s.ShowNovels }},
+	{Key: "library", Field: func(s *models.UserPrivacySettings) *bool { return &s.ShowLibrary }},
+	{Key: "achievements", Field: func(s *models.UserPrivacySettings) *bool { return &s.ShowAchievements }},
+	{Key: "stats", Field: func(s *models.UserPrivacySettings) *bool { return &s.ShowStats }},
+}
+
+// publicProfileSection es un bloque del perfil público que se obtiene de otra tabla. Solo se
+// incluye si el ajuste de privacidad Key está activo
+type publicProfileSection struct {
+	Key   string
+	Fetch func(db *gorm.DB, user *models.User) (any, error)
+}
+
+var publicProfileSections = []publicProfileSection{
+	{Key: "novels", Fetch: profileNovels},
+	{Key: "library", Fetch: profileLibrary},
+	{Key: "achievements", Fetch: profileAchievements},
+	{Key: "stats", Fetch: profileStats},
+}
+
+// maxProfileSectionItems es el máximo de elementos de cada lista del perfil público
+const maxProfileSectionItems = 50
+
+// libraryShelves son las estanterías de la biblioteca, en el orden en que se muestran
+var libraryShelves = []string{"reading", "completed", "plan_to_read", "on_hold", "dropped"}
+
+// hiddenUserStatuses son los estados de cuenta que no aparecen en perfiles, listados ni seguidores
+var hiddenUserStatuses = []models.UserStatus{models.UserStatusBaneado, models.UserStatusInactivo}
+
+// findPublicUser busca por nombre de usuario una cuenta con perfil público. Las baneadas o
+// desactivadas se tratan como inexistentes (gorm.ErrRecordNotFound)
+func findPublicUser(db *gorm.DB, username string) (*models.User, error) {
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	if slices.Contains(hiddenUserStatuses, user.Status) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// findVisibleUser es findPublicUser para un usuario concreto: quien ha sido bloqueado no ve el
+// perfil de quien lo bloqueó. viewer es "" en las peticiones sin token, que reciben la vista
+// pública. Un perfil público se puede consultar sin cuenta, así que el bloqueo no impide que el
+// bloqueado lo vea sin iniciar sesión; la privacidad es lo que protege los datos en ese caso
+func findVisibleUser(db *gorm.DB, username, viewer string) (*models.User, error) {
+	user, err := findPublicUser(db, username)
+	if err != nil || viewer == "" || viewer == user.Email {
+		return user, err
+	}
+	blocked, err := isBlockedBy(db, user.Email, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+// loadPrivacySettings devuelve los ajustes de privacidad del usuario o los de por defecto si nunca los cambió
+func loadPrivacySettings(db *gorm.DB, email string) (models.UserPrivacySettings, error) {
+	var settings models.UserPrivacySettings
+	err := db.Where("user_email = ?", email).First(&settings).Error
+	if err == gorm.ErrRecordNotFound {
+		return models.DefaultPrivacySettings(email), nil
+	}
+	return settings, err
+}
+
+// privacyInfo prepara los ajustes de privacidad para la respuesta JSON
+func privacyInfo(settings *models.UserPrivacySettings) gin.H {
+	info := gin.H{}
+	for _, setting := range privacySettings {
+		info[setting.Key] = *setting.Field(settings)
+	}
+	return info
+}
+
+// privacyVisible indica si la sección key del perfil es visible con estos ajustes
+func privacyVisible(settings *models.UserPrivacySettings, key string) bool {
+	for _, setting := range privacySettings {
+		if setting.Key == key {
+			return *setting.Field(settings)
+		}
+	}
+	return false
+}
+
+// @Summary Perfil público de un usuario
+// @Description Devuelve el perfil público del usuario: avatar, biografía, país, fecha de registro, novelas publicadas, estanterías de la biblioteca, logros y estadísticas, salvo las secciones que su dueño haya ocultado. Nunca incluye el correo electrónico. Si el usuario del token está bloqueado por el dueño del perfil, responde 404; sin token se devuelve la vista pública, que respeta la privacidad pero no los bloqueos
+// @Tags users
+// @Produce json
+// @Param Authorization header string false "Bearer JWT token"
+// @Param username path string true "Nombre de usuario"
+// @Success 200 {object} object{username=string,avatar_url=string,avatar_variants=object,role=string,followers_count=integer,following_count=integer,bio=string,country=string,joined_at=string,novels=[]object{id=integer,title=string,slug=string,description=string,cover_image_url=string,status=string,is_adult_content=boolean,language=string,total_chapters=integer,views_count=integer,rating_average=number,rating_count=integer,published_at=string},library=object,achievements=[]object{name=string,description=string,icon=string,category=string,points=integer,unlocked_at=string},stats=object{reading=object,writing=object,community=object}}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /users/{username} [get]
+func GetPublicProfile(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := findVisibleUser(db, c.Param("username"), viewerEmail(c))
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar el usuario"})
+			return
+		}
+
+		settings, err := loadPrivacySettings(db, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el perfil"})
+			return
+		}
+
+		followers, following, err := followCounts(db, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el perfil"})
+			return
+		}
+
+		profile := gin.H{
+			"username":        user.ProfileUsername,
+			"role":            string(user.Role),
+			"followers_count": followers,
+			"following_count": following,
+		}
+		if user.AvatarURL != nil {
+			profile["avatar_url"] = *user.AvatarURL
+		}
+		if len(user.AvatarVariants) > 0 {
+			profile["avatar_variants"] = user.AvatarVariants
+		}
+		if settings.ShowBio && user.Bio != nil {
+			profile["bio"] = *user.Bio
+		}
+		if settings.ShowCountry && user.Country != nil {
+			profile["country"] = *user.Country
+		}
+		if settings.ShowJoinDate {
+			profile["joined_at"] = user.CreatedAt.Format("2006-01-02T15:04:05Z07:00")
+		}
+
+		for _, section := range publicProfileSections {
+			if !privacyVisible(&settings, section.Key) {
+				continue
+			}
+			data, err := section.Fetch(db, user)
+			if err != nil {
+				fmt.Printf("Error al obtener la sección %s del perfil de %s: %v\n", section.Key, user.ProfileUsername, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el perfil"})
+				return
+			}
+			profile[section.Key] = data
+		}
+
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+// @Summary Ajustes de privacidad del perfil
+// @Description Indica qué secciones del perfil público pueden ver los demás usuarios
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{privacy=object{bio=boolean,country=boolean,join_date=boolean,novels=boolean,library=boolean,achievements=boolean,stats=boolean}}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/privacy [get]
+func GetPrivacySettings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		settings, err := loadPrivacySettings(db, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los ajustes de privacidad"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"privacy": privacyInfo(&settings)})
+	}
+}
+
+// @Summary Actualizar ajustes de privacidad del perfil
+// @Description Muestra u oculta secciones del perfil público. Los campos que no se envían conservan su valor
+// @Tags users
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param show_bio formData bool false "Mostrar la biografía"
+// @Param show_country formData bool false "Mostrar el país"
+// @Param show_join_date formData bool false "Mostrar la fecha de registro"
+// @Param show_novels formData bool false "Mostrar las novelas publicadas"
+// @Param show_library formData bool false "Mostrar las estanterías públicas de la biblioteca"
+// @Param show_achievements formData bool false "Mostrar los logros"
+// @Param show_stats formData bool false "Mostrar las estadísticas de lectura y escritura"
+// @Success 200 {object} object{message=string,privacy=object{bio=boolean,country=boolean,join_date=boolean,novels=boolean,library=boolean,achievements=boolean,stats=boolean}}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/privacy [put]
+func UpdatePrivacySettings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+
+		settings, err := loadPrivacySettings(db, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los ajustes de privacidad"})
+			return
+		}
+
+		changed := false
+		for _, setting := range privacySettings {
+			value, ok := c.GetPostForm("show_" + setting.Key)
+			if !ok {
+				continue
+			}
+			visible, err := strconv.ParseBool(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("show_%s debe ser true o false", setting.Key)})
+				return
+			}
+			*setting.Field(&settings) = visible
+			changed = true
+		}
+		if !changed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No se proporcionaron campos para actualizar"})
+			return
+		}
+
+		// Save inserta la fila la primera vez y conserva los valores false, que Updates omitiría
+		settings.UpdatedAt = time.Now()
+		if err := db.Save(&settings).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los ajustes de privacidad"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Ajustes de privacidad actualizados",
+			"privacy": privacyInfo(&settings),
+		})
+	}
+}
+
+// profileNovels devuelve las novelas publicadas por el usuario, de la más reciente a la más antigua
+func profileNovels(db *gorm.DB, user *models.User) (any, error) {
+	var novels []struct {
+		ID             uint
+		Title          string
+		Slug           string
+		Description    *string
+		CoverImageURL  *string
+		Status         string
+		IsAdultContent bool
+		Language       string
+		TotalChapters  int
+		ViewsCount     int
+		RatingAverage  float64
+		RatingCount    int
+		PublishedAt    time.Time
+	}
+	if err := db.Table("novels").
+		Select("id, title, slug, description, cover_image_url, status, is_adult_content, language, total_chapters, views_count, rating_average, rating_count, published_at").
+		Where("author_email = ? AND published_at IS NOT NULL", user.Email).
+		Order("published_at DESC").
+		Limit(maxProfileSectionItems).
+		Scan(&novels).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(novels))
+	for _, novel := range novels {
+		result = append(result, gin.H{
+			"id":               novel.ID,
+			"title":            novel.Title,
+			"slug":             novel.Slug,
+			"description":      novel.Description,
+			"cover_image_url":  novel.CoverImageURL,
+			"status":           novel.Status,
+			"is_adult_content": novel.IsAdultContent,
+			"language":         novel.Language,
+			"total_chapters":   novel.TotalChapters,
+			"views_count":      novel.ViewsCount,
+			"rating_average":   novel.RatingAverage,
+			"rating_count":     novel.RatingCount,
+			"published_at":     novel.PublishedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+// profileLibrary devuelve las estanterías de la biblioteca (leyendo, completadas...) con las
+// novelas publicadas de cada una. Las notas y la valoración personal no se muestran nunca
+func profileLibrary(db *gorm.DB, user *models.User) (any, error) {
+	shelves := gin.H{}
+	for _, shelf := range libraryShelves {
+		var entries []struct {
+			ID            uint
+			Title         string
+			Slug          string
+			CoverImageURL *string
+			IsFavorite    bool
+		}
+		if err := db.Table("user_library l").
+			Select("n.id, n.title, n.slug, n.cover_image_url, l.is_favorite").
+			Joins("JOIN novels n ON n.id = l.novel_id").
+			Where("l.user_email = ? AND l.status = ? AND n.published_at IS NOT NULL", user.Email, shelf).
+			Order("l.updated_at DESC").
+			Limit(maxProfileSectionItems).
+			Scan(&entries).Error; err != nil {
+			return nil, err
+		}
+
+		list := make([]gin.H, 0, len(entries))
+		for _, entry := range entries {
+			list = append(list, gin.H{
+				"id":              entry.ID,
+				"title":           entry.Title,
+				"slug":            entry.Slug,
+				"cover_image_url": entry.CoverImageURL,
+				"is_favorite":     entry.IsFavorite,
+			})
+		}
+		shelves[shelf] = list
+	}
+	return shelves, nil
+}
+
+// profileAchievements devuelve los logros desbloqueados, del más reciente al más antiguo
+func profileAchievements(db *gorm.DB, user *models.User) (any, error) {
+	var achievements []struct {
+		Name        string
+		Description string
+		Icon        *string
+		Category    *string
+		Points      int
+		UnlockedAt  time.Time
+	}
+	if err := db.Table("user_achievements ua").
+		Select("a.name, a.description, a.icon, a.category, a.points, ua.unlocked_at").
+		Joins("JOIN achievements a ON a.id = ua.achievement_id").
+		Where("ua.user_email = ?", user.Email).
+		Order("ua.unlocked_at DESC").
+		Scan(&achievements).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]gin.H, 0, len(achievements))
+	for _, achievement := range achievements {
+		result = append(result, gin.H{
+			"name":        achievement.Name,
+			"description": achievement.Description,
+			"icon":        achievement.Icon,
+			"category":    achievement.Category,
+			"points":      achievement.Points,
+			"unlocked_at": achievement.UnlockedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	return result, nil
+}
+
+// profileStats devuelve las estadísticas de lectura y escritura. Sin fila en user_stats todas valen 0
+func profileStats(db *gorm.DB, user *models.User) (any, error) {
+	var stats struct {
+		NovelsRead           int
+		ChaptersRead         int
+		WordsRead            int
+		ReadingTimeMinutes   int
+		NovelsWritten        int
+		ChaptersWritten      int
+		WordsWritten         int
+		TotalViewsReceived   int
+		TotalLikesReceived   int
+		CommentsMade         int
+		ReviewsWritten       int
+		AchievementsUnlocked int
+		StreakDays           int
+	}
+	if err := db.Table("user_stats").
+		Select("novels_read, chapters_read, words_read, reading_time_minutes, novels_written, chapters_written, words_written, "+
+			"total_views_received, total_likes_received, comments_made, reviews_written, achievements_unlocked, streak_days").
+		Where("user_email = ?", user.Email).
+		Limit(1).
+		Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"reading": gin.H{
+			"novels_read":          stats.NovelsRead,
+			"chapters_read":        stats.ChaptersRead,
+			"words_read":           stats.WordsRead,
+			"reading_time_minutes": stats.ReadingTimeMinutes,
+			"streak_days":          stats.StreakDays,
+		},
+		"writing": gin.H{
+			"novels_written":       stats.NovelsWritten,
+			"chapters_written":     stats.ChaptersWritten,
+			"words_written":        stats.WordsWritten,
+			"total_views_received": stats.TotalViewsReceived,
+			"total_likes_received": stats.TotalLikesReceived,
+		},
+		"community": gin.H{
+			"comments_made":         stats.CommentsMade,
+			"reviews_written":       stats.ReviewsWritten,
+			"achievements_unlocked": stats.AchievementsUnlocked,
+		},
+	}, nil
+}
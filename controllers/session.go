@@ -0,0 +1,315 @@
+package controllers
+
+import (
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/useragent"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tokenPair agrupa los tokens emitidos al iniciar o refrescar una sesión
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	Session      models.UserSession
+}
+
+// newRefreshToken genera un refresh token opaco con el formato "<id de sesión>.<secreto>".
+// Devuelve el token para el cliente y el hash del secreto que se guarda en user_sessions
+func newRefreshToken(sessionID uint) (string, string, error) {
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("%d.%s", sessionID, secret), utils.HashToken(secret), nil
+}
+
+// splitRefreshToken separa un refresh token en el id de sesión y el secreto
+func splitRefreshToken(refreshToken string) (uint, string, error) {
+	idPart, secret, found := strings.Cut(refreshToken, ".")
+	if !found || secret == "" {
+		return 0, "", fmt.Errorf("refresh token mal formado")
+	}
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil || id == 0 {
+		return 0, "", fmt.Errorf("refresh token mal formado")
+	}
+	return uint(id), secret, nil
+}
+
+// startSession registra una nueva sesión en user_sessions y emite su par de tokens
+func startSession(db *gorm.DB, c *gin.Context, email string) (*tokenPair, error) {
+	// El token definitivo depende del id, así que primero se reserva la fila con un valor único provisional
+	placeholder, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := c.ClientIP()
+	userAgent := c.Request.UserAgent()
+	now := time.Now()
+	session := models.UserSession{
+		UserEmail:    email,
+		SessionToken: utils.HashToken(placeholder),
+		IPAddress:    &ip,
+		UserAgent:    &userAgent,
+		ExpiresAt:    now.Add(middleware.RefreshTokenTTL()),
+		LastSeenAt:   &now,
+		CreatedAt:    now,
+	}
+
+	var pair tokenPair
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		refreshToken, hash, err := newRefreshToken(session.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&session).Update("session_token", hash).Error; err != nil {
+			return err
+		}
+
+		accessToken, expiresAt, err := middleware.GenerateAccessToken(email, session.ID)
+		if err != nil {
+			return err
+		}
+
+		pair = tokenPair{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresAt:    expiresAt,
+			Session:      session,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+// @Summary Refrescar tokens
+// @Description Intercambia un refresh token por un nuevo token de acceso y un nuevo refresh token. El refresh token usado queda invalidado; si se reutiliza cualquier refresh token anterior de la sesión se revoca la sesión completa
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param refresh_token formData string true "Refresh token obtenido en el login o en el último refresco"
+// @Success 200 {object} object{token=string,refresh_token=string,expires_at=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /auth/refresh [post]
+func RefreshToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refreshToken := strings.TrimSpace(c.PostForm("refresh_token"))
+		if refreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parametro refresh_token es obligatorio"})
+			return
+		}
+
+		sessionID, secret, err := splitRefreshToken(refreshToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token inválido"})
+			return
+		}
+
+		var session models.UserSession
+		if err := db.First(&session, sessionID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token inválido"})
+			return
+		}
+
+		if !session.IsActive() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "La sesión ha expirado o ha sido revocada"})
+			return
+		}
+		if session.ImpersonatorEmail != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Las sesiones de suplantación no se pueden refrescar"})
+			return
+		}
+
+		newToken, newHash, err := newRefreshToken(session.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el refresh token"})
+			return
+		}
+
+		// Rotación atómica: solo se actualiza si el token presentado sigue siendo el vigente, y el
+		// token sustituido se guarda como gastado
+		presented := utils.HashToken(secret)
+		rotated := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.UserSession{}).
+				Where("id = ? AND session_token = ? AND revoked_at IS NULL", session.ID, presented).
+				Updates(map[string]interface{}{
+					"session_token": newHash,
+					"last_seen_at":  time.Now(),
+				})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			rotated = true
+			return tx.Create(&models.SpentRefreshToken{TokenHash: presented, SessionID: session.ID}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al refrescar la sesión"})
+			return
+		}
+
+		if !rotated {
+			// Cualquier refresh token ya rotado de esta sesión indica robo y revoca la sesión entera.
+			// Un secreto que nunca fue válido no revoca nada: permitiría cerrar sesiones ajenas
+			// probando identificadores
+			var spent int64
+			if err := db.Model(&models.SpentRefreshToken{}).
+				Where("token_hash = ? AND session_id = ?", presented, session.ID).
+				Count(&spent).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al refrescar la sesión"})
+				return
+			}
+			if spent > 0 {
+				middleware.RevokeSession(db, session.ID)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reutilizado. La sesión ha sido revocada"})
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token inválido"})
+			return
+		}
+
+		accessToken, expiresAt, err := middleware.GenerateAccessToken(session.UserEmail, session.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el JWT"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"token":         accessToken,
+			"refresh_token": newToken,
+			"expires_at":    expiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+}
+
+// @Summary Listar sesiones activas
+// @Description Devuelve los dispositivos con una sesión abierta, con el navegador y sistema detectados y la última actividad. La sesión de la petición se marca con current
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{sessions=[]object{id=integer,current=boolean,ip_address=string,user_agent=string,browser=string,browser_version=string,os=string,device=string,created_at=string,last_seen_at=string,expires_at=string}}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/sessions [get]
+func ListSessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+		currentID := middleware.CurrentSessionID(c)
+
+		var sessions []models.UserSession
+		// Las sesiones de suplantación del soporte no se listan
+		if err := db.Where("user_email = ? AND revoked_at IS NULL AND expires_at > ? AND impersonator_email IS NULL", user.Email, time.Now()).
+			Order("last_seen_at DESC NULLS LAST, created_at DESC").
+			Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las sesiones"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(sessions))
+		for _, session := range sessions {
+			userAgent := ""
+			if session.UserAgent != nil {
+				userAgent = *session.UserAgent
+			}
+			device := useragent.Parse(userAgent)
+
+			item := gin.H{
+				"id":              session.ID,
+				"current":         session.ID == currentID,
+				"user_agent":      userAgent,
+				"browser":         device.Browser,
+				"browser_version": device.BrowserVersion,
+				"os":              device.OS,
+				"device":          device.Device,
+				"created_at":      session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+				"expires_at":      session.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+			}
+			if session.IPAddress != nil {
+				item["ip_address"] = *session.IPAddress
+			}
+			if session.LastSeenAt != nil {
+				item["last_seen_at"] = session.LastSeenAt.Format("2006-01-02T15:04:05Z07:00")
+			}
+			result = append(result, item)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": result})
+	}
+}
+
+// @Summary Cerrar una sesión
+// @Description Revoca una sesión del usuario (por ejemplo, la de un dispositivo perdido). Sus tokens dejan de ser válidos inmediatamente
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param id path int true "Identificador de la sesión"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 404 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/sessions/{id} [delete]
+func RevokeUserSession(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Identificador de sesión inválido"})
+			return
+		}
+
+		// Solo se pueden cerrar sesiones propias que sigan abiertas
+		var session models.UserSession
+		if err := db.Where("id = ? AND user_email = ? AND revoked_at IS NULL", id, middleware.CurrentUser(c).Email).
+			First(&session).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sesión no encontrada"})
+			return
+		}
+
+		if err := middleware.RevokeSession(db, session.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cerrar la sesión"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Sesión cerrada exitosamente"})
+	}
+}
+
+// @Summary Cerrar las demás sesiones
+// @Description Revoca todas las sesiones del usuario excepto la de la petición
+// @Tags user
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{message=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/sessions [delete]
+func RevokeOtherSessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := middleware.RevokeUserSessions(db, middleware.CurrentUser(c).Email, middleware.CurrentSessionID(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cerrar las sesiones"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Se han cerrado las demás sesiones"})
+	}
+}
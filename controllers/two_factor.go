@@ -0,0 +1,442 @@
+package controllers
+
+import (
+	"NovelUzu/constants/auth"
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/passwords"
+	"NovelUzu/utils/ratelimit"
+	"NovelUzu/utils/totp"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount es el número de códigos de recuperación que se generan cada vez
+const recoveryCodeCount = 10
+
+// recoveryCodeAlphabet evita caracteres fáciles de confundir (0/o, 1/l/i)
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// normalizeRecoveryCode elimina guiones y espacios para que el usuario pueda escribirlo como quiera
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// newRecoveryCode genera un código con el formato xxxxx-xxxxx
+func newRecoveryCode() (string, error) {
+	var sb strings.Builder
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			sb.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// replaceRecoveryCodes invalida los códigos de recuperación del usuario y genera otros nuevos
+func replaceRecoveryCodes(db *gorm.DB, email string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.RecoveryCode{
+			UserEmail: email,
+			CodeHash:  utils.HashToken(normalizeRecoveryCode(code)),
+			CreatedAt: time.Now(),
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_email = ?", email).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifyTOTPCode valida un código TOTP del usuario y lo marca como usado para que no se pueda repetir
+func verifyTOTPCode(db *gorm.DB, user *models.User, code string) (bool, error) {
+	if user.TOTPSecret == nil {
+		return false, nil
+	}
+
+	counter, ok := totp.Validate(*user.TOTPSecret, code, time.Now())
+	if !ok || counter <= user.TOTPLastCounter {
+		return false, nil
+	}
+
+	// Actualización condicional: dos peticiones simultáneas con el mismo código no pueden pasar ambas
+	result := db.Model(&models.User{}).
+		Where("email = ? AND totp_last_counter < ?", user.Email, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	user.TOTPLastCounter = counter
+	return true, nil
+}
+
+// useRecoveryCode consume un código de recuperación del usuario si es válido y no se ha usado
+func useRecoveryCode(db *gorm.DB, email, code string) (bool, error) {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_email = ? AND code_hash = ? AND used_at IS NULL", email, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// @Summary Completar inicio de sesión con 2FA
+// @Description Segundo paso del login para usuarios con verificación en dos pasos. Acepta el código TOTP o un código de recuperación
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param challenge_token formData string true "Token de reto devuelto por /login"
+// @Param code formData string false "Código de 6 dígitos de la aplicación de autenticación"
+// @Param recovery_code formData string false "Código de recuperación de un solo uso"
+// @Success 200 {object} object{message=string,token=string,refresh_token=string,expires_at=string,user=object}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string,code=string}
+// @Failure 429 {object} object{error=string,code=string,retry_after=integer}
+// @Failure 500 {object} object{error=string}
+// @Router /login/2fa [post]
+func LoginTwoFactor(db *gorm.DB, guard *ratelimit.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		challenge := c.PostForm("challenge_token")
+		code := c.PostForm("code")
+		recoveryCode := c.PostForm("recovery_code")
+
+		if challenge == "" || (code == "" && recoveryCode == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "challenge_token y code o recovery_code son obligatorios"})
+			return
+		}
+
+		email, err := middleware.ParseTwoFactorChallenge(challenge)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "El reto de verificación no es válido o ha caducado"})
+			return
+		}
+
+		// Los códigos erróneos cuentan como intentos fallidos de login
+		if wait, err := guard.Check(c.Request.Context(), email, c.ClientIP()); err != nil {
+			fmt.Printf("Error al comprobar el bloqueo de login: %v\n", err)
+		} else if wait > 0 {
+			middleware.RespondTooManyRequests(c, wait)
+			return
+		}
+
+		var user models.User
+		if err := db.Where("email = ?", email).First(&user).Error; err != nil || !user.TOTPEnabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "El reto de verificación no es válido o ha caducado"})
+			return
+		}
+
+		var valid bool
+		if code != "" {
+			valid, err = verifyTOTPCode(db, &user, code)
+		} else {
+			valid, err = useRecoveryCode(db, user.Email, recoveryCode)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el código"})
+			return
+		}
+		if !valid {
+			wait, err := guard.Fail(c.Request.Context(), email, c.ClientIP())
+			if err != nil {
+				fmt.Printf("Error al registrar el intento de login fallido: %v\n", err)
+			}
+			if wait > 0 {
+				middleware.RespondTooManyRequests(c, wait)
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Código de verificación incorrecto"})
+			return
+		}
+
+		// El estado puede haber cambiado entre los dos pasos
+		statusErr, err := middleware.CheckAccountStatus(db, &user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el estado de la cuenta"})
+			return
+		}
+		if statusErr != nil {
+			middleware.RespondAccountStatus(c, statusErr)
+			return
+		}
+
+		completeLogin(c, db, guard, &user)
+	}
+}
+
+// @Summary Iniciar el alta de 2FA
+// @Description Genera un secreto TOTP y la URI otpauth:// para mostrar como código QR. La 2FA no se activa hasta confirmarla con un código
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{secret=string,provisioning_uri=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/2fa/setup [post]
+func SetupTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+		if user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "La verificación en dos pasos ya está activada"})
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el secreto"})
+			return
+		}
+
+		if err := db.Model(user).Updates(map[string]interface{}{
+			"totp_secret":       secret,
+			"totp_last_counter": 0,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar el secreto"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":           secret,
+			"provisioning_uri": totp.ProvisioningURI(auth.TOTPIssuer, user.Email, secret),
+		})
+	}
+}
+
+// @Summary Confirmar el alta de 2FA
+// @Description Activa la verificación en dos pasos tras comprobar un código de la aplicación y devuelve los códigos de recuperación (solo se muestran esta vez)
+// @Tags users
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param code formData string true "Código de 6 dígitos de la aplicación de autenticación"
+// @Success 200 {object} object{message=string,recovery_codes=[]string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 409 {object} object{error=string}
+// @Failure 429 {object} object{error=string,code=string,retry_after=integer}
+// @Failure 500 {object} object{error=string}
+// @Router /user/2fa/confirm [post]
+func ConfirmTwoFactor(db *gorm.DB, guard *ratelimit.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+		if user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "La verificación en dos pasos ya está activada"})
+			return
+		}
+		if user.TOTPSecret == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Primero debes iniciar el alta en /user/2fa/setup"})
+			return
+		}
+
+		code := c.PostForm("code")
+		if code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parametro code es obligatorio"})
+			return
+		}
+		if !verifySecondFactor(c, db, guard, user, code, "") {
+			return
+		}
+
+		codes, err := replaceRecoveryCodes(db, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar los códigos de recuperación"})
+			return
+		}
+
+		if err := db.Model(user).Updates(map[string]interface{}{
+			"totp_enabled": true,
+			"updated_at":   time.Now(),
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al activar la verificación en dos pasos"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Verificación en dos pasos activada. Guarda los códigos de recuperación en un lugar seguro",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// @Summary Desactivar 2FA
+// @Description Desactiva la verificación en dos pasos. Requiere la contraseña y un código TOTP o de recuperación
+// @Tags users
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param password formData string true "Contraseña actual"
+// @Param code formData string false "Código de 6 dígitos de la aplicación de autenticación"
+// @Param recovery_code formData string false "Código de recuperación"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 429 {object} object{error=string,code=string,retry_after=integer}
+// @Failure 500 {object} object{error=string}
+// @Router /user/2fa [delete]
+func DisableTwoFactor(db *gorm.DB, guard *ratelimit.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+		if !user.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "La verificación en dos pasos no está activada"})
+			return
+		}
+
+		if middleware.TwoFactorRequired(user) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Tu rol exige mantener la verificación en dos pasos activada"})
+			return
+		}
+
+		if !passwords.Matches(c.PostForm("password"), user.PasswordHash) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Contraseña incorrecta"})
+			return
+		}
+
+		if !checkSecondFactor(c, db, guard, user) {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(user).Updates(map[string]interface{}{
+				"totp_enabled":      false,
+				"totp_secret":       nil,
+				"totp_last_counter": 0,
+				"updated_at":        time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Where("user_email = ?", user.Email).Delete(&models.RecoveryCode{}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al desactivar la verificación en dos pasos"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Verificación en dos pasos desactivada"})
+	}
+}
+
+// @Summary Regenerar códigos de recuperación
+// @Description Invalida los códigos de recuperación anteriores y devuelve otros nuevos. Requiere un código TOTP
+// @Tags users
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param code formData string true "Código de 6 dígitos de la aplicación de autenticación"
+// @Success 200 {object} object{recovery_codes=[]string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 429 {object} object{error=string,code=string,retry_after=integer}
+// @Failure 500 {object} object{error=string}
+// @Router /user/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(db *gorm.DB, guard *ratelimit.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+		if !user.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "La verificación en dos pasos no está activada"})
+			return
+		}
+
+		code := c.PostForm("code")
+		if code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parametro code es obligatorio"})
+			return
+		}
+		if !verifySecondFactor(c, db, guard, user, code, "") {
+			return
+		}
+
+		codes, err := replaceRecoveryCodes(db, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar los códigos de recuperación"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// checkSecondFactor valida el code o recovery_code del formulario. Si no es válido responde y devuelve false
+func checkSecondFactor(c *gin.Context, db *gorm.DB, guard *ratelimit.LoginGuard, user *models.User) bool {
+	code, recoveryCode := c.PostForm("code"), c.PostForm("recovery_code")
+	if code == "" && recoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code o recovery_code es obligatorio"})
+		return false
+	}
+	return verifySecondFactor(c, db, guard, user, code, recoveryCode)
+}
+
+// verifySecondFactor valida un código TOTP o, si code está vacío, un código de recuperación. Los
+// fallos cuentan como intentos de login fallidos de la cuenta, así que un token de acceso robado no
+// basta para adivinar el código por fuerza bruta. Si no es válido responde y devuelve false
+func verifySecondFactor(c *gin.Context, db *gorm.DB, guard *ratelimit.LoginGuard, user *models.User, code, recoveryCode string) bool {
+	if wait, err := guard.Check(c.Request.Context(), user.Email, c.ClientIP()); err != nil {
+		fmt.Printf("Error al comprobar el bloqueo de login: %v\n", err)
+	} else if wait > 0 {
+		middleware.RespondTooManyRequests(c, wait)
+		return false
+	}
+
+	var valid bool
+	var err error
+	if code != "" {
+		valid, err = verifyTOTPCode(db, user, code)
+	} else {
+		valid, err = useRecoveryCode(db, user.Email, recoveryCode)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el código"})
+		return false
+	}
+	if !valid {
+		wait, err := guard.Fail(c.Request.Context(), user.Email, c.ClientIP())
+		if err != nil {
+			fmt.Printf("Error al registrar el intento fallido: %v\n", err)
+		}
+		if wait > 0 {
+			middleware.RespondTooManyRequests(c, wait)
+			return false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Código de verificación incorrecto"})
+		return false
+	}
+
+	if err := guard.Succeed(c.Request.Context(), user.Email); err != nil {
+		fmt.Printf("Error al limpiar los intentos fallidos: %v\n", err)
+	}
+	return true
+}
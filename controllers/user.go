@@ -1,234 +1,75 @@
 package controllers
 
 import (
+	"NovelUzu/constants/auth"
 	"NovelUzu/middleware"
 	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/images"
+	"NovelUzu/utils/mailer"
+	"NovelUzu/utils/passwords"
+	"NovelUzu/utils/storage"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
-// @Summary Obtener todos los usuarios
-// @Description Retorna una lista de todos los usuarios con su información básica
-// @Tags users
-// @Produce json
-// @Param Authorization header string true "Bearer JWT token"
-// @Success 200 {array} object{username=string,email=string,role=string,status=string,avatar_url=string,created_at=string}
-// @Failure 401 {object} object{error=string}
-// @Failure 500 {object} object{error=string}
-// @Router /user/allusers [get]
-func GetAllUsers(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Verificar autenticación
-		_, err := middleware.JWT_decoder(c, db)
+// avatarFormats son los formatos en los que se guarda cada tamaño del avatar
+var avatarFormats = []images.OutputFormat{images.FormatWebP, images.FormatJPEG}
+
+// uploadAvatarVariants sube las versiones del avatar y devuelve la URL principal (el JPEG más
+// grande, que entienden todos los clientes), el JSON de avatar_variants y las claves subidas. Si
+// alguna subida falla se borran las anteriores
+func uploadAvatarVariants(ctx context.Context, store storage.Storage, variants []images.Variant) (string, json.RawMessage, []string, error) {
+	id := uuid.NewString()
+	urls := make(map[string]map[string]string)
+	keys := make([]string, 0, len(variants))
+	mainURL, mainSize := "", 0
+	for _, variant := range variants {
+		key := fmt.Sprintf("avatars/%s_%d%s", id, variant.Size, variant.Format.Ext())
+		url, err := store.Put(ctx, key, bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.Format.ContentType())
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
-			return
+			deleteStoredFiles(ctx, store, keys)
+			return "", nil, nil, err
 		}
+		keys = append(keys, key)
 
-		var users []models.User
-
-		// Obtener todos los usuarios
-		result := db.Find(&users)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener usuarios"})
-			return
-		}
-
-		// Crear un slice de datos simplificados de usuarios
-		simplifiedUsers := make([]gin.H, len(users))
-		for i, user := range users {
-			userInfo := gin.H{
-				"username":   user.ProfileUsername,
-				"email":      user.Email,
-				"role":       string(user.Role),
-				"status":     string(user.Status),
-				"created_at": user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			}
-
-			// Agregar avatar_url solo si no es nil
-			if user.AvatarURL != nil {
-				userInfo["avatar_url"] = *user.AvatarURL
-			}
-
-			simplifiedUsers[i] = userInfo
+		size := strconv.Itoa(variant.Size)
+		if urls[size] == nil {
+			urls[size] = make(map[string]string)
 		}
-
-		c.JSON(http.StatusOK, simplifiedUsers)
-	}
-}
-
-// uploadToNextcloud sube un archivo a Nextcloud y retorna la URL pública
-func uploadToNextcloud(file multipart.File, filename string) (string, error) {
-	// Configuración de Nextcloud
-	nextcloudBaseURL := os.Getenv("NEXTCLOUD_BASE_URL")
-	nextcloudURL := nextcloudBaseURL + "/remote.php/dav/files/"
-	username := os.Getenv("NEXTCLOUD_USERNAME")
-	password := os.Getenv("NEXTCLOUD_PASSWORD")
-
-	if username == "" || password == "" || nextcloudBaseURL == "" {
-		return "", fmt.Errorf("credenciales de Nextcloud no configuradas")
-	}
-
-	// Generar nombre único para el archivo
-	ext := filepath.Ext(filename)
-	uniqueFilename := fmt.Sprintf("avatar_%d%s", time.Now().Unix(), ext)
-
-	// Primero crear el directorio avatars si no existe
-	avatarsDir := fmt.Sprintf("%s%s/avatars", nextcloudURL, username)
-
-	// Crear directorio avatars
-	req, err := http.NewRequest("MKCOL", avatarsDir, nil)
-	if err == nil {
-		req.SetBasicAuth(username, password)
-		client := &http.Client{Timeout: 10 * time.Second}
-		resp, _ := client.Do(req)
-		if resp != nil {
-			resp.Body.Close()
+		urls[size][string(variant.Format)] = url
+		if variant.Format == images.FormatJPEG && variant.Size > mainSize {
+			mainURL, mainSize = url, variant.Size
 		}
 	}
 
-	uploadPath := fmt.Sprintf("avatars/%s", uniqueFilename)
-	fullURL := fmt.Sprintf("%s%s/%s", nextcloudURL, username, uploadPath)
-
-	// Leer el contenido del archivo
-	fileBytes, err := io.ReadAll(file)
-	if err != nil {
-		return "", fmt.Errorf("error al leer archivo: %v", err)
-	}
-
-	// Crear request HTTP PUT para subir el archivo
-	req, err = http.NewRequest("PUT", fullURL, bytes.NewReader(fileBytes))
-	if err != nil {
-		return "", fmt.Errorf("error al crear request: %v", err)
-	}
-
-	// Configurar autenticación básica
-	req.SetBasicAuth(username, password)
-	req.Header.Set("Content-Type", "application/octet-stream")
-
-	// Realizar la subida
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error de conexión con Nextcloud: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Leer el cuerpo de la respuesta para debug
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error en Nextcloud - Código: %d, URL: %s, Respuesta: %s", resp.StatusCode, fullURL, string(body))
-	}
-
-	// Crear enlace público para el archivo
-	publicURL, err := crearEnlacePublico(uploadPath, username, password)
-	if err != nil {
-		// Si falla la creación del enlace público, retornar la URL directa
-		fmt.Printf("Error al crear enlace público: %v\n", err)
-
-		nextcloudBaseURL := os.Getenv("NEXTCLOUD_BASE_URL")
-		if nextcloudBaseURL == "" {
-			nextcloudBaseURL = "https://nextcloud.eslus.org"
-		}
-
-		directURL := fmt.Sprintf("%s/remote.php/dav/files/%s/%s", nextcloudBaseURL, username, uploadPath)
-		return directURL, nil
-	}
-
-	return publicURL, nil
-}
-
-// crearEnlacePublico crea un enlace público para un archivo en Nextcloud
-func crearEnlacePublico(ruta, username, password string) (string, error) {
-	nextcloudBaseURL := os.Getenv("NEXTCLOUD_BASE_URL")
-	if nextcloudBaseURL == "" {
-		nextcloudBaseURL = "https://nextcloud.eslus.org" // fallback por defecto
-	}
-
-	url := nextcloudBaseURL + "/ocs/v2.php/apps/files_sharing/api/v1/shares"
-	data := "path=/" + ruta + "&shareType=3&permissions=1"
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(data))
-	if err != nil {
-		return "", fmt.Errorf("error al crear request: %v", err)
-	}
-
-	req.Header.Set("OCS-APIRequest", "true")
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.SetBasicAuth(username, password)
-
-	// Debug: imprimir la URL y datos que se están enviando
-	fmt.Printf("Creando enlace público - URL: %s, Data: %s\n", url, data)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error de conexión: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	raw, err := json.Marshal(urls)
 	if err != nil {
-		return "", fmt.Errorf("error al leer respuesta: %v", err)
-	}
-
-	// Debug: imprimir la respuesta XML completa
-	fmt.Printf("Respuesta XML crearEnlacePublico (Status: %d): %s\n", resp.StatusCode, string(body))
-
-	// Trabajar directamente con XML - verificar si el status es ok
-	if strings.Contains(string(body), "<status>ok</status>") {
-		return extraerTokenDeXML(string(body))
-	} else {
-		// Extraer el mensaje de error del XML
-		messageStart := strings.Index(string(body), "<message>")
-		messageEnd := strings.Index(string(body), "</message>")
-		if messageStart != -1 && messageEnd != -1 && messageStart < messageEnd {
-			errorMsg := string(body)[messageStart+9 : messageEnd]
-			return "", fmt.Errorf("error en Nextcloud: %s", errorMsg)
-		}
-		return "", fmt.Errorf("error en respuesta XML de Nextcloud")
+		deleteStoredFiles(ctx, store, keys)
+		return "", nil, nil, err
 	}
+	return mainURL, raw, keys, nil
 }
 
-// extraerTokenDeXML extrae el token de compartición de una respuesta XML de Nextcloud
-func extraerTokenDeXML(xmlResponse string) (string, error) {
-	// Primero intentar extraer la URL completa que ya viene formateada
-	urlStart := strings.Index(xmlResponse, "<url>")
-	urlEnd := strings.Index(xmlResponse, "</url>")
-
-	if urlStart != -1 && urlEnd != -1 && urlStart < urlEnd {
-		url := xmlResponse[urlStart+5 : urlEnd]
-		return url, nil
-	}
-
-	// Si no encuentra URL, buscar el token para construir la URL manualmente
-	tokenStart := strings.Index(xmlResponse, "<token>")
-	tokenEnd := strings.Index(xmlResponse, "</token>")
-
-	if tokenStart == -1 || tokenEnd == -1 || tokenStart >= tokenEnd {
-		return "", fmt.Errorf("no se pudo extraer token ni URL de la respuesta XML")
-	}
-
-	token := xmlResponse[tokenStart+7 : tokenEnd]
-
-	nextcloudBaseURL := os.Getenv("NEXTCLOUD_BASE_URL")
-	if nextcloudBaseURL == "" {
-		nextcloudBaseURL = "https://nextcloud.eslus.org" // fallback por defecto
+// deleteStoredFiles borra archivos del almacenamiento. Los errores solo se registran: un archivo
+// huérfano no debe hacer fallar la petición
+func deleteStoredFiles(ctx context.Context, store storage.Storage, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			fmt.Printf("Error al borrar el archivo %s: %v\n", key, err)
+		}
 	}
-
-	publicURL := fmt.Sprintf("%s/s/%s", nextcloudBaseURL, token)
-	return publicURL, nil
 }
 
 // @Summary Actualizar perfil de usuario
@@ -241,30 +82,22 @@ func extraerTokenDeXML(xmlResponse string) (string, error) {
 // @Param bio formData string false "Biografía del usuario"
 // @Param birth_date formData string false "Fecha de nacimiento (YYYY-MM-DD)"
 // @Param country formData string false "País del usuario"
-// @Param avatar formData file false "Imagen de avatar (JPG, PNG)"
+// @Param avatar formData file false "Imagen de avatar (JPEG, PNG, GIF o WebP, máximo 5MB). Se recorta al centro y se guarda en varios tamaños en WebP y JPEG"
 // @Success 200 {object} object{message=string,user=object}
 // @Failure 400 {object} object{error=string}
 // @Failure 401 {object} object{error=string}
 // @Failure 500 {object} object{error=string}
 // @Router /user/update [put]
-func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
+func UpdateProfile(db *gorm.DB, store storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Verificar autenticación
-		email, err := middleware.JWT_decoder(c, db)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
-			return
-		}
-
-		// Buscar usuario actual
-		var user models.User
-		if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
-			return
-		}
+		// Usuario autenticado (cargado por AuthRequired)
+		user := middleware.CurrentUser(c)
+		email := user.Email
 
 		// Crear mapa para actualizaciones
 		updates := make(map[string]interface{})
+		// Archivos del avatar nuevo: se borran los del anterior si se guarda y estos si no
+		var newAvatarKeys []string
 
 		// Procesar campos de texto
 		if username := c.PostForm("username"); username != "" {
@@ -294,34 +127,50 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 			updates["country"] = country
 		}
 
-		// Procesar archivo de avatar
-		file, header, err := c.Request.FormFile("avatar")
+		// Procesar archivo de avatar. El tipo se detecta por el contenido, no por la cabecera del
+		// cliente, y la imagen se vuelve a codificar, lo que elimina sus metadatos (EXIF, GPS...)
+		file, _, err := c.Request.FormFile("avatar")
 		if err == nil {
 			defer file.Close()
 
-			// Validar tipo de archivo
-			contentType := header.Header.Get("Content-Type")
-			if !strings.HasPrefix(contentType, "image/") {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo debe ser una imagen"})
+			data, err := images.ReadLimited(file, images.AvatarLimits)
+			if err != nil {
+				if errors.Is(err, images.ErrTooLarge) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo es demasiado grande (máximo 5MB)"})
+					return
+				}
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Error al leer la imagen"})
 				return
 			}
 
-			// Validar tamaño (max 5MB)
-			if header.Size > 5*1024*1024 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo es demasiado grande (máximo 5MB)"})
+			variants, err := images.SquareVariants(data, images.AvatarLimits, images.AvatarSizes, avatarFormats)
+			if err != nil {
+				switch {
+				case errors.Is(err, images.ErrDimensions):
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("La imagen debe medir entre %d y %d píxeles de lado y no superar los %d megapíxeles",
+						images.AvatarLimits.MinSide, images.AvatarLimits.MaxSide, images.AvatarLimits.MaxPixels/1_000_000)})
+				case errors.Is(err, images.ErrUnsupportedFormat):
+					c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo debe ser una imagen JPEG, PNG, GIF o WebP"})
+				case errors.Is(err, images.ErrCorrupt):
+					c.JSON(http.StatusBadRequest, gin.H{"error": "La imagen está dañada o no se puede leer"})
+				default:
+					fmt.Printf("Error al procesar el avatar: %v\n", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al procesar la imagen"})
+				}
 				return
 			}
 
-			// Intentar subir a Nextcloud
-			avatarURL, err := uploadToNextcloud(file, header.Filename)
+			avatarURL, avatarVariants, keys, err := uploadAvatarVariants(c.Request.Context(), store, variants)
 			if err != nil {
-				// Si falla la subida a Nextcloud, log el error pero continúa sin la imagen
-				fmt.Printf("Error al subir a Nextcloud: %v\n", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al subir imagen. Verifique la configuración de Nextcloud"})
+				fmt.Printf("Error al subir el avatar: %v\n", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al subir la imagen"})
 				return
 			}
 
+			newAvatarKeys = keys
 			updates["avatar_url"] = avatarURL
+			updates["avatar_variants"] = avatarVariants
+			updates["avatar_keys"] = strings.Join(keys, " ")
 		}
 
 		// Si no hay actualizaciones, retornar error
@@ -334,10 +183,15 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 		updates["updated_at"] = time.Now()
 
 		// Realizar actualización en la base de datos
-		if err := db.Model(&user).Updates(updates).Error; err != nil {
+		oldAvatarKeys := strings.Fields(user.AvatarKeys)
+		if err := db.Model(user).Updates(updates).Error; err != nil {
+			deleteStoredFiles(c.Request.Context(), store, newAvatarKeys)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar perfil"})
 			return
 		}
+		if newAvatarKeys != nil {
+			deleteStoredFiles(c.Request.Context(), store, oldAvatarKeys)
+		}
 
 		// Buscar usuario actualizado para retornar
 		var updatedUser models.User
@@ -361,6 +215,9 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 		if updatedUser.AvatarURL != nil {
 			userResponse["avatar_url"] = *updatedUser.AvatarURL
 		}
+		if len(updatedUser.AvatarVariants) > 0 {
+			userResponse["avatar_variants"] = updatedUser.AvatarVariants
+		}
 		if updatedUser.Bio != nil {
 			userResponse["bio"] = *updatedUser.Bio
 		}
@@ -379,7 +236,7 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 }
 
 // @Summary Cambiar contraseña del usuario
-// @Description Permite cambiar la contraseña del usuario después de verificar la contraseña actual
+// @Description Permite cambiar la contraseña del usuario después de verificar la contraseña actual. Cierra el resto de sesiones abiertas y revoca los tokens de acceso personal
 // @Tags users
 // @Accept x-www-form-urlencoded
 // @Produce json
@@ -387,7 +244,7 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 // @Param current_password formData string true "Contraseña actual"
 // @Param new_password formData string true "Nueva contraseña"
 // @Success 200 {object} object{message=string}
-// @Failure 400 {object} object{error=string}
+// @Failure 400 {object} object{error=string,code=string,details=object{score=integer,min_score=integer,violations=[]object{code=string,message=string}}}
 // @Failure 401 {object} object{error=string}
 // @Failure 403 {object} object{error=string}
 // @Failure 404 {object} object{error=string}
@@ -395,13 +252,6 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 // @Router /user/change-password [put]
 func ChangePassword(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Verificar autenticación
-		email, err := middleware.JWT_decoder(c, db)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
-			return
-		}
-
 		// Obtener parámetros
 		currentPassword := c.PostForm("current_password")
 		newPassword := c.PostForm("new_password")
@@ -412,47 +262,53 @@ func ChangePassword(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Validar longitud de nueva contraseña
-		if len(newPassword) < 6 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "La nueva contraseña debe tener al menos 6 caracteres"})
-			return
-		}
-
-		// Buscar usuario actual
-		var user models.User
-		if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
-			return
-		}
+		// Usuario autenticado (cargado por AuthRequired)
+		user := middleware.CurrentUser(c)
 
 		// Verificar contraseña actual
-		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		if !passwords.Matches(currentPassword, user.PasswordHash) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "La contraseña actual es incorrecta"})
 			return
 		}
 
 		// Verificar que la nueva contraseña sea diferente a la actual
-		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(newPassword)); err == nil {
+		if passwords.Matches(newPassword, user.PasswordHash) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "La nueva contraseña debe ser diferente a la actual"})
 			return
 		}
 
+		// Aplicar la política de contraseñas
+		if !checkNewPassword(c, newPassword, user.ProfileUsername, user.Email) {
+			return
+		}
+
 		// Hashear nueva contraseña
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+		hashedPassword, err := hashPassword(newPassword)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al procesar la nueva contraseña"})
 			return
 		}
 
 		// Actualizar contraseña en la base de datos
-		if err := db.Model(&user).Updates(map[string]interface{}{
-			"password_hash": string(hashedPassword),
+		if err := db.Model(user).Updates(map[string]interface{}{
+			"password_hash": hashedPassword,
 			"updated_at":    time.Now(),
 		}).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar la contraseña"})
 			return
 		}
 
+		// Cerrar el resto de sesiones y los tokens de acceso personal: si la contraseña estaba
+		// comprometida, lo que se haya obtenido con ella deja de valer
+		if err := middleware.RevokeUserSessions(db, user.Email, middleware.CurrentSessionID(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cerrar las demás sesiones"})
+			return
+		}
+		if err := middleware.RevokePersonalTokens(db, user.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al revocar los tokens de acceso personal"})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Contraseña cambiada exitosamente",
 		})
@@ -460,28 +316,21 @@ func ChangePassword(db *gorm.DB) gin.HandlerFunc {
 }
 
 // @Summary Eliminar cuenta de usuario
-// @Description Elimina permanentemente la cuenta del usuario después de verificar la contraseña
+// @Description Programa la eliminación de la cuenta tras verificar la contraseña. Se cierran todas las sesiones y, si el usuario no vuelve a iniciar sesión antes de que acabe el periodo de gracia, se borran sus datos personales y su contenido queda anonimizado
 // @Tags users
 // @Accept x-www-form-urlencoded
 // @Produce json
 // @Param Authorization header string true "Bearer JWT token"
 // @Param password formData string true "Contraseña actual para confirmar eliminación"
-// @Success 200 {object} object{message=string}
+// @Success 200 {object} object{message=string,deletion_scheduled_at=string}
 // @Failure 400 {object} object{error=string}
 // @Failure 401 {object} object{error=string}
 // @Failure 403 {object} object{error=string}
 // @Failure 404 {object} object{error=string}
 // @Failure 500 {object} object{error=string}
 // @Router /user/delete-account [delete]
-func DeleteAccount(db *gorm.DB) gin.HandlerFunc {
+func DeleteAccount(db *gorm.DB, mailSender mailer.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Verificar autenticación
-		email, err := middleware.JWT_decoder(c, db)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
-			return
-		}
-
 		// Obtener contraseña de confirmación
 		password := c.PostForm("password")
 		if password == "" {
@@ -489,27 +338,55 @@ func DeleteAccount(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Buscar usuario actual
-		var user models.User
-		if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
-			return
-		}
+		// Usuario autenticado (cargado por AuthRequired)
+		user := middleware.CurrentUser(c)
 
 		// Verificar contraseña actual
-		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		if !passwords.Matches(password, user.PasswordHash) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Contraseña incorrecta"})
 			return
 		}
 
-		// Eliminar el usuario de la base de datos
-		if err := db.Delete(&user).Error; err != nil {
+		// Programar la eliminación y revocar los tokens de acceso personal: iniciar sesión de nuevo
+		// es la forma de cancelarla
+		now := time.Now()
+		scheduledAt := now.Add(utils.DurationFromEnv("ACCOUNT_DELETION_GRACE", auth.DefaultAccountDeletionGrace))
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(user).Updates(map[string]interface{}{
+				"deletion_scheduled_at": scheduledAt,
+				"pending_email":         nil,
+				"email_change_token":    nil,
+				"email_change_expires":  nil,
+				"updated_at":            now,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.PersonalAccessToken{}).
+				Where("user_email = ? AND revoked_at IS NULL", user.Email).
+				Update("revoked_at", now).Error
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar la cuenta"})
 			return
 		}
 
+		if err := middleware.RevokeUserSessions(db, user.Email, 0); err != nil {
+			fmt.Printf("Error al cerrar las sesiones de la cuenta eliminada: %v\n", err)
+		}
+
+		if err := mailSender.Send(mailer.Message{
+			To:      user.Email,
+			Subject: "Tu cuenta de NovelUzu se eliminará pronto",
+			Body: fmt.Sprintf("Hola %s,\n\nHemos recibido tu solicitud para eliminar tu cuenta de NovelUzu. Se eliminará definitivamente el %s.\n\n"+
+				"Si cambias de opinión, basta con que inicies sesión antes de esa fecha para cancelar la eliminación.\n",
+				user.ProfileUsername, scheduledAt.Format("02/01/2006 15:04")),
+		}); err != nil {
+			fmt.Printf("Error al enviar el aviso de eliminación de cuenta: %v\n", err)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"message": "Cuenta eliminada exitosamente",
+			"message":               "Tu cuenta se eliminará al finalizar el periodo de gracia. Inicia sesión antes de esa fecha si quieres cancelarlo",
+			"deletion_scheduled_at": scheduledAt.Format("2006-01-02T15:04:05Z07:00"),
 		})
 	}
 }
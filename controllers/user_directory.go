@@ -0,0 +1,389 @@
+package controllers
+
+import (
+	models "NovelUzu/models/postgres"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUsersPage = 20
+	maxUsersPage     = 100
+)
+
+// likeEscaper escapa los comodines de LIKE para buscar el texto tal cual
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// userDirectoryFilter son los filtros del directorio de usuarios. Los de estado y fecha de
+// registro solo los usan los administradores
+type userDirectoryFilter struct {
+	Admin       bool
+	Viewer      string
+	Prefix      string
+	Role        models.UserRole
+	Status      models.UserStatus
+	Country     string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// userCursor marca la última fila devuelta. Lleva la ordenación para rechazar cursores de otra
+// consulta y desempata por username, que es único (el correo no puede salir en el listado público)
+type userCursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	Username  string    `json:"u"`
+	CreatedAt time.Time `json:"c"`
+}
+
+// userDirectoryPage es la ordenación y la posición de una página del directorio
+type userDirectoryPage struct {
+	Limit  int
+	Sort   string
+	Desc   bool
+	Cursor *userCursor
+}
+
+func parseUserDirectoryFilter(c *gin.Context, admin bool) (userDirectoryFilter, string) {
+	filter := userDirectoryFilter{Admin: admin}
+
+	filter.Prefix = strings.TrimSpace(c.Query("q"))
+	if len(filter.Prefix) > 50 {
+		return filter, "q no puede superar los 50 caracteres"
+	}
+
+	if value := c.Query("role"); value != "" {
+		filter.Role = models.UserRole(value)
+		if filter.Role != models.UserRoleUsuario && filter.Role != models.UserRoleAdmin {
+			return filter, "Rol inválido. Valores permitidos: usuario, admin"
+		}
+	}
+
+	filter.Country = strings.TrimSpace(c.Query("country"))
+
+	if !admin {
+		return filter, ""
+	}
+
+	if value := c.Query("status"); value != "" {
+		filter.Status = models.UserStatus(value)
+		if !filter.Status.IsValid() {
+			return filter, "Estado inválido. Valores permitidos: activo, inactivo, suspendido, baneado"
+		}
+	}
+	if value := c.Query("created_from"); value != "" {
+		from, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return filter, "Formato de created_from inválido. Use YYYY-MM-DD"
+		}
+		filter.CreatedFrom = &from
+	}
+	if value := c.Query("created_to"); value != "" {
+		to, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return filter, "Formato de created_to inválido. Use YYYY-MM-DD"
+		}
+		// created_to incluye el día completo
+		to = to.AddDate(0, 0, 1)
+		filter.CreatedTo = &to
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return filter, "created_from no puede ser posterior a created_to"
+	}
+
+	return filter, ""
+}
+
+// scope aplica los filtros a una consulta sobre users
+func (f userDirectoryFilter) scope(tx *gorm.DB) *gorm.DB {
+	if f.Prefix != "" {
+		tx = tx.Where("LOWER(username) LIKE ?", strings.ToLower(likeEscaper.Replace(f.Prefix))+"%")
+	}
+	if f.Role != "" {
+		tx = tx.Where("role = ?", f.Role)
+	}
+	if f.Country != "" {
+		tx = tx.Where("LOWER(country) = LOWER(?)", f.Country)
+		// Quien oculta su país no aparece al filtrar por él
+		if !f.Admin {
+			tx = tx.Where("NOT EXISTS (SELECT 1 FROM user_privacy_settings p WHERE p.user_email = users.email AND NOT p.show_country)")
+		}
+	}
+	if f.Admin {
+		if f.Status != "" {
+			tx = tx.Where("status = ?", f.Status)
+		}
+		if f.CreatedFrom != nil {
+			tx = tx.Where("created_at >= ?", *f.CreatedFrom)
+		}
+		if f.CreatedTo != nil {
+			tx = tx.Where("created_at < ?", *f.CreatedTo)
+		}
+	} else {
+		// Igual que en el perfil público, las cuentas baneadas o desactivadas no se listan, ni las
+		// que han bloqueado a quien consulta o este ha bloqueado o silenciado
+		tx = tx.Where("status NOT IN ?", hiddenUserStatuses).Scopes(hideBlockedUsers(f.Viewer, "users.email"))
+	}
+	return tx
+}
+
+// parseUserDirectoryPage lee limit, sort, order y cursor. El listado público solo se ordena por
+// nombre de usuario para no revelar el orden de registro de quien oculta su fecha
+func parseUserDirectoryPage(c *gin.Context, admin bool) (userDirectoryPage, string) {
+	page := userDirectoryPage{Limit: defaultUsersPage, Sort: "username"}
+
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxUsersPage {
+			return page, "limit debe estar entre 1 y 100"
+		}
+		page.Limit = n
+	}
+
+	if value := c.Query("sort"); value != "" {
+		if value != "username" && (value != "created_at" || !admin) {
+			if admin {
+				return page, "sort inválido. Valores permitidos: username, created_at"
+			}
+			return page, "sort inválido. Valores permitidos: username"
+		}
+		page.Sort = value
+	}
+
+	// Por defecto los nombres van en orden alfabético y las fechas de la más reciente a la más antigua
+	page.Desc = page.Sort == "created_at"
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		page.Desc = false
+	case "desc":
+		page.Desc = true
+	default:
+		return page, "order inválido. Valores permitidos: asc, desc"
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		var cursor userCursor
+		if err != nil || json.Unmarshal(raw, &cursor) != nil || cursor.Username == "" {
+			return page, "cursor inválido"
+		}
+		if cursor.Sort != page.Sort || cursor.Desc != page.Desc {
+			return page, "El cursor pertenece a otra ordenación"
+		}
+		page.Cursor = &cursor
+	}
+
+	return page, ""
+}
+
+// encodeUserCursor genera el cursor que apunta a la página siguiente a user
+func encodeUserCursor(page userDirectoryPage, user *models.User) string {
+	cursor := userCursor{Sort: page.Sort, Desc: page.Desc, Username: user.ProfileUsername}
+	if page.Sort == "created_at" {
+		cursor.CreatedAt = user.CreatedAt
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// findUserDirectory devuelve una página del directorio, el total de usuarios que cumplen los
+// filtros y el cursor de la página siguiente ("" si es la última)
+func findUserDirectory(db *gorm.DB, filter userDirectoryFilter, page userDirectoryPage) ([]models.User, int64, string, error) {
+	var total int64
+	if err := db.Model(&models.User{}).Scopes(filter.scope).Count(&total).Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	direction, comparison := "ASC", ">"
+	if page.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	query := db.Scopes(filter.scope)
+	if cursor := page.Cursor; cursor != nil {
+		if page.Sort == "created_at" {
+			query = query.Where("(created_at, username) "+comparison+" (?, ?)", cursor.CreatedAt, cursor.Username)
+		} else {
+			query = query.Where("username "+comparison+" ?", cursor.Username)
+		}
+	}
+	if page.Sort == "created_at" {
+		query = query.Order("created_at " + direction)
+	}
+
+	// Se pide una fila de más para saber si hay página siguiente
+	var users []models.User
+	if err := query.Order("username " + direction).Limit(page.Limit + 1).Find(&users).Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	next := ""
+	if len(users) > page.Limit {
+		users = users[:page.Limit]
+		next = encodeUserCursor(page, &users[len(users)-1])
+	}
+	return users, total, next, nil
+}
+
+// @Summary Directorio de usuarios
+// @Description Lista paginada de usuarios con la información pública de su perfil. Se busca por prefijo del nombre de usuario y se filtra por rol y país (quien oculta su país no aparece al filtrar por él). Para la página siguiente se pasa en cursor el next_cursor recibido
+// @Tags users
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param q query string false "Prefijo del nombre de usuario"
+// @Param role query string false "Rol (usuario, admin)"
+// @Param country query string false "País"
+// @Param sort query string false "Ordenación (username)"
+// @Param order query string false "asc (por defecto) o desc"
+// @Param limit query int false "Usuarios por página (por defecto 20, máximo 100)"
+// @Param cursor query string false "Cursor de la página siguiente"
+// @Success 200 {object} object{users=[]object{username=string,role=string,avatar_url=string,country=string,joined_at=string},total=integer,next_cursor=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /user/allusers [get]
+func GetAllUsers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, message := parseUserDirectoryFilter(c, false)
+		if message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		filter.Viewer = viewerEmail(c)
+		page, message := parseUserDirectoryPage(c, false)
+		if message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+
+		users, total, next, err := findUserDirectory(db, filter, page)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener usuarios"})
+			return
+		}
+
+		// Ajustes de privacidad de los usuarios de la página; sin fila se muestra todo
+		emails := make([]string, len(users))
+		for i := range users {
+			emails[i] = users[i].Email
+		}
+		privacy := make(map[string]models.UserPrivacySettings, len(users))
+		if len(emails) > 0 {
+			var rows []models.UserPrivacySettings
+			if err := db.Where("user_email IN ?", emails).Find(&rows).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener usuarios"})
+				return
+			}
+			for _, row := range rows {
+				privacy[row.UserEmail] = row
+			}
+		}
+
+		result := make([]gin.H, 0, len(users))
+		for _, user := range users {
+			settings, ok := privacy[user.Email]
+			if !ok {
+				settings = models.DefaultPrivacySettings(user.Email)
+			}
+
+			userInfo := gin.H{
+				"username": user.ProfileUsername,
+				"role":     string(user.Role),
+			}
+			if user.AvatarURL != nil {
+				userInfo["avatar_url"] = *user.AvatarURL
+			}
+			if settings.ShowCountry && user.Country != nil {
+				userInfo["country"] = *user.Country
+			}
+			if settings.ShowJoinDate {
+				userInfo["joined_at"] = user.CreatedAt.Format("2006-01-02T15:04:05Z07:00")
+			}
+			result = append(result, userInfo)
+		}
+
+		response := gin.H{"users": result, "total": total}
+		if next != "" {
+			response["next_cursor"] = next
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// @Summary Listado completo de usuarios
+// @Description Lista paginada de todos los usuarios con correo y estado de la cuenta. Se busca por prefijo del nombre de usuario y se filtra por rol, estado, país y fecha de registro. Para la página siguiente se pasa en cursor el next_cursor recibido. Solo para administradores
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param q query string false "Prefijo del nombre de usuario"
+// @Param role query string false "Rol (usuario, admin)"
+// @Param status query string false "Estado (activo, inactivo, suspendido, baneado)"
+// @Param country query string false "País"
+// @Param created_from query string false "Registrados desde este día (YYYY-MM-DD)"
+// @Param created_to query string false "Registrados hasta este día incluido (YYYY-MM-DD)"
+// @Param sort query string false "Ordenación (username, created_at)"
+// @Param order query string false "asc o desc (por defecto asc para username y desc para created_at)"
+// @Param limit query int false "Usuarios por página (por defecto 20, máximo 100)"
+// @Param cursor query string false "Cursor de la página siguiente"
+// @Success 200 {object} object{users=[]object{username=string,email=string,role=string,status=string,suspended_until=string,email_verified=boolean,avatar_url=string,country=string,last_login=string,deletion_scheduled_at=string,created_at=string},total=integer,next_cursor=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 403 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /admin/users [get]
+func ListUsers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, message := parseUserDirectoryFilter(c, true)
+		if message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		page, message := parseUserDirectoryPage(c, true)
+		if message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+
+		users, total, next, err := findUserDirectory(db, filter, page)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener usuarios"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(users))
+		for _, user := range users {
+			userInfo := gin.H{
+				"username":              user.ProfileUsername,
+				"email":                 user.Email,
+				"role":                  string(user.Role),
+				"status":                string(user.Status),
+				"suspended_until":       formatOptionalTime(user.SuspendedUntil),
+				"email_verified":        user.EmailVerified,
+				"last_login":            formatOptionalTime(user.LastLogin),
+				"deletion_scheduled_at": formatOptionalTime(user.DeletionScheduledAt),
+				"created_at":            user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			}
+			if user.AvatarURL != nil {
+				userInfo["avatar_url"] = *user.AvatarURL
+			}
+			if user.Country != nil {
+				userInfo["country"] = *user.Country
+			}
+			result = append(result, userInfo)
+		}
+
+		response := gin.H{"users": result, "total": total}
+		if next != "" {
+			response["next_cursor"] = next
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"NovelUzu/constants/auth"
+	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+	"NovelUzu/utils/mailer"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// frontendURL devuelve la URL base del frontend (FRONTEND_URL) sin barra final
+func frontendURL() string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return strings.TrimRight(base, "/")
+}
+
+// frontendLink construye un enlace al frontend con el token como parámetro
+func frontendLink(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", frontendURL(), path, url.QueryEscape(token))
+}
+
+// sendVerificationEmail genera un nuevo token de verificación, guarda su hash y lo envía al usuario
+func sendVerificationEmail(db *gorm.DB, mail mailer.Mailer, user *models.User) error {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	hash := utils.HashToken(token)
+	expires := time.Now().Add(utils.DurationFromEnv("EMAIL_VERIFICATION_TTL", auth.DefaultEmailVerificationTTL))
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"email_verification_token":   hash,
+		"email_verification_expires": expires,
+	}).Error; err != nil {
+		return err
+	}
+
+	return mail.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verifica tu correo en NovelUzu",
+		Body: fmt.Sprintf("Hola %s,\n\nPara verificar tu dirección de correo abre el siguiente enlace:\n\n%s\n\n"+
+			"El enlace caduca el %s. Si no has creado una cuenta en NovelUzu puedes ignorar este mensaje.\n",
+			user.ProfileUsername, frontendLink("/verify-email", token), expires.Format("02/01/2006 15:04")),
+	})
+}
+
+// @Summary Verificar correo electrónico
+// @Description Marca el correo del usuario como verificado a partir del token recibido por email
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token de verificación recibido por correo"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /verify-email [post]
+func VerifyEmail(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(c.PostForm("token"))
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El parametro token es obligatorio"})
+			return
+		}
+
+		var user models.User
+		if err := db.Where("email_verification_token = ?", utils.HashToken(token)).First(&user).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Token de verificación inválido"})
+			return
+		}
+
+		if user.EmailVerificationExpires == nil || time.Now().After(*user.EmailVerificationExpires) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El token de verificación ha caducado"})
+			return
+		}
+
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"email_verified":             true,
+			"email_verification_token":   nil,
+			"email_verification_expires": nil,
+			"updated_at":                 time.Now(),
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el correo"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Correo verificado exitosamente"})
+	}
+}
+
+// @Summary Reenviar correo de verificación
+// @Description Genera un nuevo token de verificación (invalidando el anterior) y lo envía por correo
+// @Tags auth
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{error=string}
+// @Failure 401 {object} object{error=string}
+// @Failure 500 {object} object{error=string}
+// @Router /auth/resend-verification [post]
+func ResendVerification(db *gorm.DB, mail mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.CurrentUser(c)
+		if user.EmailVerified {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El correo ya está verificado"})
+			return
+		}
+
+		if err := sendVerificationEmail(db, mail, user); err != nil {
+			fmt.Printf("Error al enviar el correo de verificación: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al enviar el correo de verificación"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Correo de verificación enviado"})
+	}
+}
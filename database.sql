@@ -14,20 +14,33 @@ CREATE TYPE subscription_status AS ENUM ('activa', 'cancelada', 'expirada');
 CREATE TABLE users (
     email VARCHAR(255) PRIMARY KEY,
     username VARCHAR(50) UNIQUE NOT NULL,
-    password_hash VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL, -- formato PHC ($argon2id$...) o bcrypt heredado
     role user_role DEFAULT 'usuario',
     status user_status DEFAULT 'activo',
+    suspended_until TIMESTAMP, -- fin de la suspensión temporal (NULL = indefinida)
+    suspension_reason TEXT,
     avatar_url TEXT,
+    avatar_variants JSONB, -- URLs del avatar por tamaño y formato: {"64": {"webp": ..., "jpeg": ...}}
+    avatar_keys TEXT NOT NULL DEFAULT '', -- Claves de esos archivos en el almacenamiento, separadas por espacios
     bio TEXT,
     birth_date DATE,
     country VARCHAR(100),
     email_verified BOOLEAN DEFAULT FALSE,
-    email_verification_token VARCHAR(255),
-    password_reset_token VARCHAR(255),
+    email_verification_token VARCHAR(255), -- SHA-256 del token enviado por correo
+    email_verification_expires TIMESTAMP,
+    password_reset_token VARCHAR(255), -- SHA-256 del token de un solo uso
     password_reset_expires TIMESTAMP,
+    pending_email VARCHAR(255), -- nuevo correo pendiente de confirmar
+    email_change_token VARCHAR(255), -- SHA-256 del token enviado al nuevo correo
+    email_change_expires TIMESTAMP,
+    totp_secret VARCHAR(64), -- secreto TOTP en base32 (se guarda al iniciar el alta)
+    totp_enabled BOOLEAN DEFAULT FALSE,
+    totp_last_counter BIGINT DEFAULT 0, -- último periodo usado, evita reutilizar códigos
     last_login TIMESTAMP,
+    deletion_scheduled_at TIMESTAMP, -- fin del periodo de gracia de una eliminación solicitada
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP -- cuenta eliminada: datos personales borrados y usuario anonimizado
 );
 
 -- Tabla de géneros
@@ -46,7 +59,8 @@ CREATE TABLE novels (
     slug VARCHAR(255) UNIQUE NOT NULL,
     description TEXT,
     cover_image_url TEXT,
-    author_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    -- Como los comentarios, las novelas se conservan al anonimizar la cuenta de su autor
+    author_email VARCHAR(255) REFERENCES users(email) ON UPDATE CASCADE ON DELETE SET NULL,
     status novel_status DEFAULT 'en_progreso',
     is_premium BOOLEAN DEFAULT FALSE,
     is_adult_content BOOLEAN DEFAULT FALSE,
@@ -95,7 +109,8 @@ CREATE TABLE chapters (
 -- Tabla de comentarios
 CREATE TABLE comments (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    -- Al eliminar una cuenta el usuario se anonimiza en lugar de borrarse, así que los comentarios se conservan
+    user_email VARCHAR(255) REFERENCES users(email) ON UPDATE CASCADE ON DELETE SET NULL,
     novel_id INTEGER REFERENCES novels(id) ON DELETE CASCADE,
     chapter_id INTEGER REFERENCES chapters(id) ON DELETE CASCADE,
     parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
@@ -110,19 +125,19 @@ CREATE TABLE comments (
 -- Tabla de valoraciones
 CREATE TABLE ratings (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    user_email VARCHAR(255) REFERENCES users(email) ON UPDATE CASCADE ON DELETE SET NULL,
     novel_id INTEGER REFERENCES novels(id) ON DELETE CASCADE,
     rating INTEGER CHECK (rating >= 1 AND rating <= 5),
     review TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(user_id, novel_id)
+    UNIQUE(user_email, novel_id)
 );
 
 -- Tabla de biblioteca de usuario
 CREATE TABLE user_library (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    user_email VARCHAR(255) REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
     novel_id INTEGER REFERENCES novels(id) ON DELETE CASCADE,
     status VARCHAR(20) DEFAULT 'reading', -- reading, completed, plan_to_read, dropped, on_hold
     is_favorite BOOLEAN DEFAULT FALSE,
@@ -130,19 +145,19 @@ CREATE TABLE user_library (
     personal_notes TEXT,
     added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(user_id, novel_id)
+    UNIQUE(user_email, novel_id)
 );
 
 -- Tabla de historial de lectura
 CREATE TABLE reading_history (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    user_email VARCHAR(255) REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
     novel_id INTEGER REFERENCES novels(id) ON DELETE CASCADE,
     chapter_id INTEGER REFERENCES chapters(id) ON DELETE CASCADE,
     progress_percentage DECIMAL(5,2) DEFAULT 0.00,
     last_read_position INTEGER DEFAULT 0, -- Posición en el texto
     read_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(user_id, chapter_id)
+    UNIQUE(user_email, chapter_id)
 );
 
 -- Tabla de suscripciones a novelas
@@ -174,7 +189,7 @@ CREATE TABLE reports (
 -- Tabla de notificaciones
 CREATE TABLE notifications (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    user_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
     type notification_type NOT NULL,
     title VARCHAR(255) NOT NULL,
     message TEXT NOT NULL,
@@ -186,7 +201,7 @@ CREATE TABLE notifications (
 -- Tabla de estadísticas de usuario
 CREATE TABLE user_stats (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE UNIQUE,
+    user_email VARCHAR(255) UNIQUE REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
     novels_read INTEGER DEFAULT 0,
     chapters_read INTEGER DEFAULT 0,
     words_read INTEGER DEFAULT 0,
@@ -221,21 +236,21 @@ CREATE TABLE achievements (
 -- Tabla de logros de usuario
 CREATE TABLE user_achievements (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    user_email VARCHAR(255) REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
     achievement_id INTEGER REFERENCES achievements(id) ON DELETE CASCADE,
     unlocked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(user_id, achievement_id)
+    UNIQUE(user_email, achievement_id)
 );
 
 -- Tabla de marcadores
 CREATE TABLE bookmarks (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    user_email VARCHAR(255) REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
     chapter_id INTEGER REFERENCES chapters(id) ON DELETE CASCADE,
     position INTEGER NOT NULL,
     note TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(user_id, chapter_id, position)
+    UNIQUE(user_email, chapter_id, position)
 );
 
 -- Tabla de etiquetas personalizadas
@@ -276,7 +291,7 @@ CREATE TABLE premium_subscriptions (
 CREATE TABLE system_events (
     id SERIAL PRIMARY KEY,
     event_type VARCHAR(50) NOT NULL,
-    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    user_email VARCHAR(255) REFERENCES users(email) ON UPDATE CASCADE ON DELETE SET NULL,
     novel_id INTEGER REFERENCES novels(id) ON DELETE SET NULL,
     chapter_id INTEGER REFERENCES chapters(id) ON DELETE SET NULL,
     data JSONB,
@@ -288,14 +303,108 @@ CREATE TABLE system_events (
 -- Tabla de sesiones
 CREATE TABLE user_sessions (
     id SERIAL PRIMARY KEY,
-    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-    session_token VARCHAR(255) UNIQUE NOT NULL,
+    user_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    session_token VARCHAR(255) UNIQUE NOT NULL, -- SHA-256 del refresh token vigente
     ip_address INET,
     user_agent TEXT,
     expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    last_seen_at TIMESTAMP, -- última petición autenticada (se actualiza como mucho una vez por minuto)
+    impersonator_email VARCHAR(255), -- administrador que abrió la sesión para suplantar al usuario
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Refresh tokens ya rotados de cada sesión, para detectar su reutilización
+CREATE TABLE spent_refresh_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY, -- SHA-256 del refresh token
+    session_id INTEGER NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+    spent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tabla de códigos de recuperación de la verificación en dos pasos
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL, -- SHA-256 del código
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Cuentas de proveedores OpenID Connect vinculadas a usuarios
+CREATE TABLE external_identities (
+    id SERIAL PRIMARY KEY,
+    user_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL, -- claim sub del proveedor
+    email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(provider, subject),
+    UNIQUE(user_email, provider)
+);
+
+-- Tokens de acceso personal para aplicaciones de terceros
+CREATE TABLE personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 del token
+    token_prefix VARCHAR(16) NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '', -- ámbitos separados por espacios
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    last_used_ip INET,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tabla de exportaciones de datos personales (ZIP generado en segundo plano)
+CREATE TABLE data_exports (
+    id SERIAL PRIMARY KEY,
+    user_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pendiente', -- pendiente, procesando, listo, error, caducado
+    file_path TEXT,
+    file_size BIGINT DEFAULT 0,
+    token_hash VARCHAR(64) UNIQUE, -- SHA-256 del token del enlace de descarga
+    error TEXT,
+    expires_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tabla de ajustes de privacidad del perfil público (sin fila = todo visible)
+CREATE TABLE user_privacy_settings (
+    user_email VARCHAR(255) PRIMARY KEY REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    show_bio BOOLEAN NOT NULL DEFAULT TRUE,
+    show_country BOOLEAN NOT NULL DEFAULT TRUE,
+    show_join_date BOOLEAN NOT NULL DEFAULT TRUE,
+    show_novels BOOLEAN NOT NULL DEFAULT TRUE,
+    show_library BOOLEAN NOT NULL DEFAULT TRUE,
+    show_achievements BOOLEAN NOT NULL DEFAULT TRUE,
+    show_stats BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tabla de seguidores (follower_email sigue a followed_email)
+CREATE TABLE user_follows (
+    id SERIAL PRIMARY KEY,
+    follower_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    followed_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(follower_email, followed_email),
+    CHECK (follower_email <> followed_email)
+);
+
+-- Tabla de bloqueos y silencios (user_email bloquea o silencia a blocked_email)
+CREATE TABLE user_blocks (
+    id SERIAL PRIMARY KEY,
+    user_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    blocked_email VARCHAR(255) NOT NULL REFERENCES users(email) ON UPDATE CASCADE ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL, -- bloqueo, silencio
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_email, blocked_email),
+    CHECK (user_email <> blocked_email)
+);
+
 -- Tabla de configuración del sistema
 CREATE TABLE system_config (
     id SERIAL PRIMARY KEY,
@@ -310,8 +419,10 @@ CREATE INDEX idx_users_email ON users(email);
 CREATE INDEX idx_users_username ON users(username);
 CREATE INDEX idx_users_role ON users(role);
 CREATE INDEX idx_users_status ON users(status);
+CREATE INDEX idx_users_created_at ON users(created_at, username);
+CREATE INDEX idx_users_username_prefix ON users(LOWER(username) text_pattern_ops); -- búsqueda por prefijo en el directorio
 
-CREATE INDEX idx_novels_author ON novels(author_id);
+CREATE INDEX idx_novels_author ON novels(author_email);
 CREATE INDEX idx_novels_status ON novels(status);
 CREATE INDEX idx_novels_published ON novels(published_at);
 CREATE INDEX idx_novels_rating ON novels(rating_average);
@@ -325,23 +436,23 @@ CREATE INDEX idx_chapters_number ON chapters(novel_id, chapter_number);
 
 CREATE INDEX idx_comments_novel ON comments(novel_id);
 CREATE INDEX idx_comments_chapter ON comments(chapter_id);
-CREATE INDEX idx_comments_user ON comments(user_id);
+CREATE INDEX idx_comments_user ON comments(user_email);
 CREATE INDEX idx_comments_parent ON comments(parent_id);
 CREATE INDEX idx_comments_status ON comments(status);
 
 CREATE INDEX idx_ratings_novel ON ratings(novel_id);
-CREATE INDEX idx_ratings_user ON ratings(user_id);
+CREATE INDEX idx_ratings_user ON ratings(user_email);
 CREATE INDEX idx_ratings_rating ON ratings(rating);
 
-CREATE INDEX idx_library_user ON user_library(user_id);
+CREATE INDEX idx_library_user ON user_library(user_email);
 CREATE INDEX idx_library_novel ON user_library(novel_id);
 CREATE INDEX idx_library_status ON user_library(status);
 
-CREATE INDEX idx_reading_history_user ON reading_history(user_id);
+CREATE INDEX idx_reading_history_user ON reading_history(user_email);
 CREATE INDEX idx_reading_history_novel ON reading_history(novel_id);
 CREATE INDEX idx_reading_history_chapter ON reading_history(chapter_id);
 
-CREATE INDEX idx_notifications_user ON notifications(user_id);
+CREATE INDEX idx_notifications_user ON notifications(user_email);
 CREATE INDEX idx_notifications_read ON notifications(is_read);
 CREATE INDEX idx_notifications_created ON notifications(created_at);
 
@@ -349,3 +460,17 @@ CREATE INDEX idx_reports_status ON reports(status);
 CREATE INDEX idx_reports_type ON reports(type);
 CREATE INDEX idx_reports_created ON reports(created_at);
 
+CREATE INDEX idx_user_sessions_user ON user_sessions(user_email);
+CREATE INDEX idx_spent_refresh_tokens_session ON spent_refresh_tokens(session_id);
+CREATE INDEX idx_recovery_codes_user ON recovery_codes(user_email);
+CREATE INDEX idx_personal_tokens_user ON personal_access_tokens(user_email);
+CREATE INDEX idx_data_exports_user ON data_exports(user_email);
+CREATE INDEX idx_system_events_user ON system_events(user_email);
+CREATE INDEX idx_system_events_type ON system_events(event_type);
+CREATE INDEX idx_system_events_created ON system_events(created_at);
+CREATE INDEX idx_system_events_feed ON system_events(user_email, id); -- feed de los seguidores
+CREATE INDEX idx_user_follows_followed ON user_follows(followed_email);
+CREATE INDEX idx_user_blocks_blocked ON user_blocks(blocked_email);
+CREATE INDEX idx_users_deletion_scheduled ON users(deletion_scheduled_at);
+CREATE INDEX idx_users_deleted_at ON users(deleted_at);
+
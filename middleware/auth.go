@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 
 	"NovelUzu/constants/auth"
@@ -16,85 +17,171 @@ import (
 	"gorm.io/gorm"
 )
 
-// AuthRequired is a simple middleware to check the session.
-func AuthRequired(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
-		c.Abort()
-		return
-	}
+// AuthRequired checks the access token and that its session has not been revoked,
+// and stores the authenticated user in the gin.Context. It also accepts personal access
+// tokens (auth.PersonalTokenPrefix), but only on routes that declare a scope with
+// AllowPersonalTokens before it, and only if the token has that scope. Requests made
+// with an impersonation token are recorded in system_events before they are handled
+func AuthRequired(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := bearerToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+			c.Abort()
+			return
+		}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
-		c.Abort()
-		return
-	}
+		var email, impersonator string
+		var sessionID uint
+		var personalToken *models.PersonalAccessToken
+
+		if strings.HasPrefix(tokenString, auth.PersonalTokenPrefix) {
+			personalToken, err = authenticatePersonalToken(db, tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido, caducado o revocado"})
+				c.Abort()
+				return
+			}
+			// Por defecto las rutas no admiten tokens: así una ruta nueva sin AllowPersonalTokens
+			// no queda al alcance de cualquier token, tenga el ámbito que tenga
+			if !checkPersonalTokenScope(c, personalToken) {
+				return
+			}
+			email = personalToken.UserEmail
+		} else {
+			// parseAccessToken rechaza tokens expirados o sin exp
+			claims, err := parseAccessToken(tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+				c.Abort()
+				return
+			}
 
-	secret := os.Getenv("KEY")
+			email, err = emailFromClaims(claims)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+				c.Abort()
+				return
+			}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verificar el método de firma
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unauthorized")
+			sessionID, err = SessionIDFromClaims(claims)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+				c.Abort()
+				return
+			}
+			impersonator = actorFromClaims(claims)
+
+			// Comprobar que la sesión no ha sido revocada (logout, cambio de contraseña...)
+			active, err := isSessionActive(db, sessionID, email)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar la sesión"})
+				c.Abort()
+				return
+			}
+			if !active {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "La sesión ha sido revocada"})
+				c.Abort()
+				return
+			}
 		}
-		return []byte(secret), nil
-	})
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
-		c.Abort()
-		return
-	}
-	c.Next()
-}
 
-func JWT_decoder(c *gin.Context, db *gorm.DB) (string, error) {
-	// Obtener el token del encabezado Authorization
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		return "", fmt.Errorf("unauthorized")
-	}
+		// Cargar el usuario una sola vez; los handlers lo leen con CurrentUser
+		var user models.User
+		if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+			c.Abort()
+			return
+		}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		return "", fmt.Errorf("unauthorized")
-	}
+		// Una cuenta baneada, suspendida o inactiva pierde el acceso aunque tenga tokens válidos
+		statusErr, err := CheckAccountStatus(db, &user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el estado de la cuenta"})
+			c.Abort()
+			return
+		}
+		if statusErr != nil {
+			RespondAccountStatus(c, statusErr)
+			c.Abort()
+			return
+		}
+
+		if personalToken != nil {
+			touchPersonalToken(db, personalToken, c.ClientIP())
+			c.Set(auth.ContextTokenID, personalToken.ID)
+			c.Set(auth.ContextTokenScopes, personalToken.ScopeList())
+		} else {
+			touchSession(db, sessionID)
+			c.Set(auth.ContextSessionID, sessionID)
+		}
+
+		c.Set(auth.ContextEmail, email)
+		c.Set(auth.ContextUser, &user)
 
-	// Parsear el JWT
-	secret := os.Getenv("KEY")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verificar el método de firma
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unauthorized")
+		if impersonator == "" {
+			c.Next()
+			return
 		}
-		return []byte(secret), nil
-	})
 
-	// Verificar si el token es válido
-	if err != nil || !token.Valid {
-		return "", fmt.Errorf("unauthorized")
+		// Todas las peticiones de una suplantación quedan registradas, también las rechazadas. El
+		// registro se guarda antes de atenderla: si no se puede guardar, la petición no se ejecuta
+		eventID, err := auditImpersonatedRequest(db, c, impersonator, email, sessionID)
+		if err != nil {
+			fmt.Printf("Error al registrar la petición suplantada de %s como %s: %v\n", impersonator, email, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la petición suplantada"})
+			return
+		}
+		c.Set(auth.ContextImpersonator, impersonator)
+		c.Next()
+		recordImpersonatedStatus(db, eventID, c.Writer.Status())
 	}
+}
 
-	// Obtener los datos del token
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("unauthorized")
+// OptionalAuth autentica la petición igual que AuthRequired si trae la cabecera Authorization y
+// la deja pasar sin usuario si no la trae. Es para rutas públicas cuya respuesta depende de quién
+// las consulta (p. ej. perfiles que el usuario autenticado tiene prohibido ver)
+func OptionalAuth(db *gorm.DB) gin.HandlerFunc {
+	required := AuthRequired(db)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		required(c)
 	}
+}
 
-	// Verificar que el email existe en los claims
-	emailClaim, exists := claims[auth.Email]
-	if !exists {
-		return "", fmt.Errorf("unauthorized")
+func JWT_decoder(c *gin.Context, db *gorm.DB) (string, error) {
+	// Obtener el token del encabezado Authorization
+	tokenString, err := bearerToken(c)
+	if err != nil {
+		return "", err
 	}
 
-	email, ok := emailClaim.(string)
-	if !ok {
-		return "", fmt.Errorf("unauthorized")
+	// Parsear y validar el JWT
+	claims, err := parseAccessToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+
+	// Verificar que el email existe en los claims
+	email, err := emailFromClaims(claims)
+	if err != nil {
+		return "", err
 	}
 
-	// Verificar que el usuario existe en la base de datos (solo si db no es nil)
+	// Verificar que la sesión sigue activa y el usuario existe (solo si db no es nil)
 	if db != nil {
+		sessionID, err := SessionIDFromClaims(claims)
+		if err != nil {
+			return "", err
+		}
+		active, err := isSessionActive(db, sessionID, email)
+		if err != nil || !active {
+			return "", fmt.Errorf("unauthorized")
+		}
+
 		var user models.User
 		if err := db.Where("email = ?", email).First(&user).Error; err != nil {
 			return "", fmt.Errorf("unauthorized")
@@ -104,47 +191,62 @@ func JWT_decoder(c *gin.Context, db *gorm.DB) (string, error) {
 	return email, nil
 }
 
-func Socketio_JWT_decoder(authData map[string]interface{}) (string, error) {
-	// Obtener el token del authData
+// socketClaims valida el token de acceso que el cliente de Socket.IO envía en auth.authorization
+func socketClaims(authData map[string]interface{}) (jwt.MapClaims, error) {
 	tokenStringRaw, ok := authData["authorization"].(string)
 	if !ok {
-		return "", fmt.Errorf("unauthorized")
+		return nil, fmt.Errorf("unauthorized")
 	}
 
 	tokenString := strings.TrimPrefix(tokenStringRaw, "Bearer ")
+	return parseAccessToken(tokenString)
+}
 
-	// Parsear el JWT
-	secret := os.Getenv("KEY")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verificar el método de firma
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unauthorized")
-		}
-		return []byte(secret), nil
-	})
+// AuthenticateSocket hace con el handshake de Socket.IO las mismas comprobaciones que AuthRequired:
+// token de acceso válido, sesión no revocada y cuenta en un estado que permite usarla.
+// Devuelve el usuario y el id de la sesión para que el gateway pueda revalidarla más tarde
+func AuthenticateSocket(db *gorm.DB, authData map[string]interface{}) (*models.User, uint, error) {
+	claims, err := socketClaims(authData)
+	if err != nil {
+		return nil, 0, err
+	}
+	email, err := emailFromClaims(claims)
+	if err != nil {
+		return nil, 0, err
+	}
+	sessionID, err := SessionIDFromClaims(claims)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	if err != nil || !token.Valid {
-		return "", fmt.Errorf("unauthorized")
+	// Los eventos del socket no pasan por la auditoría de las suplantaciones
+	if actorFromClaims(claims) != "" {
+		return nil, 0, fmt.Errorf("las suplantaciones no pueden usar la conexión en tiempo real")
 	}
 
-	// Obtener los datos del token
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("unauthorized")
+	active, err := isSessionActive(db, sessionID, email)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !active {
+		return nil, 0, fmt.Errorf("la sesión ha sido revocada")
 	}
 
-	// Verificar que el email existe en los claims
-	emailClaim, exists := claims[auth.Email]
-	if !exists {
-		return "", fmt.Errorf("unauthorized")
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, 0, fmt.Errorf("unauthorized")
 	}
 
-	email, ok := emailClaim.(string)
-	if !ok {
-		return "", fmt.Errorf("unauthorized")
+	statusErr, err := CheckAccountStatus(db, &user)
+	if err != nil {
+		return nil, 0, err
+	}
+	if statusErr != nil {
+		return nil, 0, fmt.Errorf("%s", statusErr.Message)
 	}
 
-	return email, nil
+	touchSession(db, sessionID)
+	return &user, sessionID, nil
 }
 
 // me is the handler that will return the user information stored in the
@@ -159,3 +261,49 @@ func me(c *gin.Context) {
 func status(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"estado": "Sesión activa"})
 }
+
+// unverifiedRestrictions devuelve las acciones prohibidas a cuentas sin verificar según UNVERIFIED_RESTRICTIONS.
+// Un valor "none" desactiva todas las restricciones
+func unverifiedRestrictions() []string {
+	value, defined := os.LookupEnv("UNVERIFIED_RESTRICTIONS")
+	if !defined {
+		return auth.DefaultUnverifiedRestrictions
+	}
+
+	var actions []string
+	for _, action := range strings.Split(value, ",") {
+		action = strings.TrimSpace(strings.ToLower(action))
+		if action != "" && action != "none" {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// RequireVerifiedEmail bloquea la acción indicada (p. ej. auth.ActionComment) a los usuarios que
+// no han verificado su correo, si esa acción está en UNVERIFIED_RESTRICTIONS. Debe ir después de AuthRequired
+func RequireVerifiedEmail(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(unverifiedRestrictions(), action) {
+			c.Next()
+			return
+		}
+
+		user := CurrentUser(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+			c.Abort()
+			return
+		}
+
+		if !user.EmailVerified {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Debes verificar tu correo electrónico para realizar esta acción",
+				"code":  "email_not_verified",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
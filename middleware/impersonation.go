@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"NovelUzu/constants/auth"
+	models "NovelUzu/models/postgres"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CodeImpersonationForbidden identifica las acciones que no se permiten durante una suplantación
+const CodeImpersonationForbidden = "impersonation_forbidden"
+
+// Impersonator devuelve el correo del administrador que suplanta al usuario, o "" si no hay suplantación
+func Impersonator(c *gin.Context) string {
+	return c.GetString(auth.ContextImpersonator)
+}
+
+// BlockImpersonation impide usar la ruta con un token de suplantación: la contraseña, el correo,
+// la verificación en dos pasos, los tokens y la eliminación de la cuenta solo los gestiona su dueño.
+// Debe ir después de AuthRequired
+func BlockImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Impersonator(c) != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Esta acción no está permitida mientras se suplanta a un usuario",
+				"code":  CodeImpersonationForbidden,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RecordSystemEvent guarda un evento en system_events con la IP y el navegador de la petición
+func RecordSystemEvent(db *gorm.DB, c *gin.Context, eventType, userEmail string, data any) error {
+	_, err := createSystemEvent(db, c, eventType, userEmail, data)
+	return err
+}
+
+// createSystemEvent guarda el evento y devuelve su id
+func createSystemEvent(db *gorm.DB, c *gin.Context, eventType, userEmail string, data any) (uint, error) {
+	event := models.SystemEvent{
+		EventType: eventType,
+		CreatedAt: time.Now(),
+	}
+	if userEmail != "" {
+		event.UserEmail = &userEmail
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return 0, err
+		}
+		event.Data = raw
+	}
+	if c != nil {
+		ip := c.ClientIP()
+		userAgent := c.Request.UserAgent()
+		event.IPAddress = &ip
+		event.UserAgent = &userAgent
+	}
+	if err := db.Create(&event).Error; err != nil {
+		return 0, err
+	}
+	return event.ID, nil
+}
+
+// auditImpersonatedRequest registra una petición hecha con un token de suplantación antes de
+// atenderla, para que ninguna se ejecute sin quedar registrada. Devuelve el id del evento
+func auditImpersonatedRequest(db *gorm.DB, c *gin.Context, impersonator, email string, sessionID uint) (uint, error) {
+	return createSystemEvent(db, c, models.EventImpersonationRequest, email, gin.H{
+		"impersonator": impersonator,
+		"session_id":   sessionID,
+		"method":       c.Request.Method,
+		"path":         c.Request.URL.Path,
+		"route":        c.FullPath(),
+	})
+}
+
+// recordImpersonatedStatus completa el registro de la petición suplantada con su código de respuesta
+func recordImpersonatedStatus(db *gorm.DB, eventID uint, status int) {
+	err := db.Model(&models.SystemEvent{}).
+		Where("id = ?", eventID).
+		Update("data", gorm.Expr("data || jsonb_build_object('status', ?::int)", status)).Error
+	if err != nil {
+		fmt.Printf("Error al registrar la respuesta de la petición suplantada %d: %v\n", eventID, err)
+	}
+}
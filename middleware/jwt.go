@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"NovelUzu/constants/auth"
+	"NovelUzu/utils"
+	"NovelUzu/utils/jwtkeys"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// signingKeys guarda el gestor de claves compartido por todos los tokens que firma la API
+var signingKeys struct {
+	once    sync.Once
+	manager *jwtkeys.Manager
+	err     error
+}
+
+// SigningKeys devuelve el gestor de claves de JWT, que se carga del entorno la primera vez
+func SigningKeys() (*jwtkeys.Manager, error) {
+	signingKeys.once.Do(func() {
+		signingKeys.manager, signingKeys.err = jwtkeys.FromEnv()
+	})
+	return signingKeys.manager, signingKeys.err
+}
+
+// signToken firma los claims con la clave activa
+func signToken(claims jwt.MapClaims) (string, error) {
+	keys, err := SigningKeys()
+	if err != nil {
+		return "", err
+	}
+	return keys.Sign(claims)
+}
+
+// AccessTokenTTL devuelve la duración de los tokens de acceso
+func AccessTokenTTL() time.Duration {
+	return utils.DurationFromEnv("ACCESS_TOKEN_TTL", auth.DefaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL devuelve la duración de los refresh tokens (y por tanto de la sesión)
+func RefreshTokenTTL() time.Duration {
+	return utils.DurationFromEnv("REFRESH_TOKEN_TTL", auth.DefaultRefreshTokenTTL)
+}
+
+// GenerateAccessToken firma un JWT de acceso de corta duración asociado a una sesión
+func GenerateAccessToken(email string, sessionID uint) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL())
+
+	tokenString, err := signToken(jwt.MapClaims{
+		auth.Email:     email,
+		auth.SessionID: sessionID,
+		auth.TokenType: auth.TokenTypeAccess,
+		"jti":          uuid.NewString(),
+		"iat":          now.Unix(),
+		"exp":          expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+// GenerateImpersonationToken firma el token de acceso de una sesión de suplantación. Lleva el
+// administrador en el claim act y caduca con la sesión; no hay refresh token
+func GenerateImpersonationToken(email string, sessionID uint, impersonator string, expiresAt time.Time) (string, error) {
+	return signToken(jwt.MapClaims{
+		auth.Email:     email,
+		auth.SessionID: sessionID,
+		auth.TokenType: auth.TokenTypeAccess,
+		auth.Actor:     map[string]interface{}{"sub": impersonator},
+		"jti":          uuid.NewString(),
+		"iat":          time.Now().Unix(),
+		"exp":          expiresAt.Unix(),
+	})
+}
+
+// actorFromClaims devuelve el administrador que suplanta al usuario, o "" si el token es del propio usuario
+func actorFromClaims(claims jwt.MapClaims) string {
+	actor, ok := claims[auth.Actor].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	sub, _ := actor["sub"].(string)
+	return sub
+}
+
+// parseAccessToken verifica la firma, la expiración y el tipo de un token de acceso
+func parseAccessToken(tokenString string) (jwt.MapClaims, error) {
+	return parseToken(tokenString, auth.TokenTypeAccess)
+}
+
+// parseToken verifica la firma y la expiración de un token y que sea del tipo esperado
+func parseToken(tokenString, expectedType string) (jwt.MapClaims, error) {
+	keys, err := SigningKeys()
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	// La clave se elige por el kid de la cabecera y su algoritmo debe coincidir con el del token
+	token, err := jwt.Parse(tokenString, keys.Keyfunc,
+		jwt.WithValidMethods(keys.Algorithms()), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	// Un token de otro tipo (p. ej. el reto de 2FA) nunca sirve como token de acceso
+	if tokenType, _ := claims[auth.TokenType].(string); tokenType != expectedType {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	return claims, nil
+}
+
+// generatePurposeToken firma un token de corta duración que solo sirve para el propósito indicado por tokenType
+func generatePurposeToken(email, tokenType string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	tokenString, err := signToken(jwt.MapClaims{
+		auth.Email:     email,
+		auth.TokenType: tokenType,
+		"jti":          uuid.NewString(),
+		"iat":          now.Unix(),
+		"exp":          expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+// GenerateTwoFactorChallenge firma el token de corta duración que se entrega tras validar la
+// contraseña de un usuario con 2FA. Solo sirve para completar el login en /login/2fa
+func GenerateTwoFactorChallenge(email string) (string, time.Time, error) {
+	return generatePurposeToken(email, auth.TokenTypeTwoFactorChallenge, auth.TwoFactorChallengeTTL)
+}
+
+// ParseTwoFactorChallenge valida un token de reto de 2FA y devuelve el email del usuario
+func ParseTwoFactorChallenge(tokenString string) (string, error) {
+	claims, err := parseToken(tokenString, auth.TokenTypeTwoFactorChallenge)
+	if err != nil {
+		return "", err
+	}
+	return emailFromClaims(claims)
+}
+
+// GenerateOIDCLinkTicket firma el ticket con el que un usuario autenticado inicia, mediante una
+// redirección del navegador, la vinculación de una cuenta de un proveedor OIDC
+func GenerateOIDCLinkTicket(email string) (string, time.Time, error) {
+	return generatePurposeToken(email, auth.TokenTypeOIDCLink, auth.OIDCLinkTicketTTL)
+}
+
+// ParseOIDCLinkTicket valida un ticket de vinculación OIDC y devuelve el email del usuario
+func ParseOIDCLinkTicket(tokenString string) (string, error) {
+	claims, err := parseToken(tokenString, auth.TokenTypeOIDCLink)
+	if err != nil {
+		return "", err
+	}
+	return emailFromClaims(claims)
+}
+
+// emailFromClaims extrae el email de los claims de un token
+func emailFromClaims(claims jwt.MapClaims) (string, error) {
+	email, ok := claims[auth.Email].(string)
+	if !ok || email == "" {
+		return "", fmt.Errorf("unauthorized")
+	}
+	return email, nil
+}
+
+// SessionIDFromClaims extrae el identificador de sesión de los claims de un token
+func SessionIDFromClaims(claims jwt.MapClaims) (uint, error) {
+	// encoding/json decodifica los números como float64
+	sid, ok := claims[auth.SessionID].(float64)
+	if !ok || sid <= 0 {
+		return 0, fmt.Errorf("unauthorized")
+	}
+	return uint(sid), nil
+}
+
+// bearerToken extrae el token del encabezado Authorization
+func bearerToken(c *gin.Context) (string, error) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		return "", fmt.Errorf("unauthorized")
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return "", fmt.Errorf("unauthorized")
+	}
+	return tokenString, nil
+}
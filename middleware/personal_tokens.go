@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"NovelUzu/constants/auth"
+	models "NovelUzu/models/postgres"
+	"NovelUzu/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Códigos de error de los tokens de acceso personal
+const (
+	CodeInsufficientScope = "insufficient_scope"
+	CodeSessionRequired   = "session_required"
+)
+
+// authenticatePersonalToken busca un token de acceso personal vigente a partir de su valor en claro
+func authenticatePersonalToken(db *gorm.DB, tokenString string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	if err := db.Where("token_hash = ?", utils.HashToken(tokenString)).First(&token).Error; err != nil {
+		return nil, err
+	}
+	if !token.IsActive() {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	return &token, nil
+}
+
+// touchPersonalToken registra el último uso del token, como mucho una vez por sessionTouchInterval
+func touchPersonalToken(db *gorm.DB, token *models.PersonalAccessToken, ip string) {
+	now := time.Now()
+	if !shouldTouch(fmt.Sprintf("token:%d", token.ID), now) {
+		return
+	}
+
+	err := db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", token.ID, now.Add(-sessionTouchInterval)).
+		Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		}).Error
+	if err != nil {
+		fmt.Printf("Error al actualizar el uso del token %d: %v\n", token.ID, err)
+	}
+}
+
+// TokenScopes devuelve los ámbitos del token de acceso personal con el que se autenticó la
+// petición. El segundo valor es false si la petición usa una sesión normal (sin restricciones)
+func TokenScopes(c *gin.Context) ([]string, bool) {
+	value, exists := c.Get(auth.ContextTokenScopes)
+	if !exists {
+		return nil, false
+	}
+	scopes, _ := value.([]string)
+	return scopes, true
+}
+
+// RevokePersonalTokens revoca todos los tokens de acceso personal del usuario
+func RevokePersonalTokens(db *gorm.DB, email string) error {
+	return db.Model(&models.PersonalAccessToken{}).
+		Where("user_email = ? AND revoked_at IS NULL", email).
+		Update("revoked_at", time.Now()).Error
+}
+
+// AllowPersonalTokens declara que la ruta admite tokens de acceso personal con el ámbito indicado.
+// Debe ir antes de AuthRequired u OptionalAuth, que rechazan los tokens en cualquier ruta que no
+// lo declare y comprueban que el token tenga el ámbito. Las peticiones con sesión (JWT) no se ven
+// afectadas
+func AllowPersonalTokens(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(auth.ContextAllowedScope, scope)
+		c.Next()
+	}
+}
+
+// checkPersonalTokenScope rechaza la petición si la ruta no admite tokens de acceso personal o el
+// token no tiene el ámbito que pide. Devuelve false si la ha rechazado
+func checkPersonalTokenScope(c *gin.Context, token *models.PersonalAccessToken) bool {
+	scope := c.GetString(auth.ContextAllowedScope)
+	if scope == "" {
+		respondSessionRequired(c)
+		return false
+	}
+	if !slices.Contains(token.ScopeList(), scope) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "El token no tiene el ámbito necesario para esta acción",
+			"code":  CodeInsufficientScope,
+			"scope": scope,
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// respondSessionRequired rechaza una petición hecha con un token de acceso personal
+func respondSessionRequired(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": "Esta acción requiere iniciar sesión; no se puede realizar con un token de acceso personal",
+		"code":  CodeSessionRequired,
+	})
+	c.Abort()
+}
+
+// RequireSession rechaza los tokens de acceso personal. Se usa en las rutas que gestionan la
+// propia cuenta (contraseña, 2FA, sesiones, tokens...) y que nunca deben estar al alcance de un
+// cliente externo, aunque alguien les añada AllowPersonalTokens. Debe ir después de AuthRequired
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isToken := TokenScopes(c); isToken {
+			respondSessionRequired(c)
+			return
+		}
+		c.Next()
+	}
+}
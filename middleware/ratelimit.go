@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"NovelUzu/utils/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CodeRateLimited es el código de error devuelto cuando se supera un límite o hay un bloqueo
+const CodeRateLimited = "rate_limited"
+
+// KeyByIP identifica al cliente por su IP
+func KeyByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// RateLimit limita las peticiones por cliente (según keyFunc) de cualquier ruta o grupo
+func RateLimit(limiter *ratelimit.Limiter, keyFunc func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := limiter.Allow(c.Request.Context(), keyFunc(c))
+		if err != nil {
+			// Si el almacén no responde se deja pasar la petición antes que tumbar el servicio
+			fmt.Printf("Error en el limitador de peticiones: %v\n", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+
+		if !result.Allowed {
+			RespondTooManyRequests(c, result.RetryAfter)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RespondTooManyRequests responde 429 con la cabecera Retry-After en segundos
+func RespondTooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Demasiados intentos. Inténtalo de nuevo más tarde",
+		"code":        CodeRateLimited,
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"NovelUzu/constants/auth"
+	models "NovelUzu/models/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrentUser devuelve el usuario autenticado que AuthRequired guardó en el contexto, o nil
+func CurrentUser(c *gin.Context) *models.User {
+	value, exists := c.Get(auth.ContextUser)
+	if !exists {
+		return nil
+	}
+	user, _ := value.(*models.User)
+	return user
+}
+
+// RequireRole permite el paso solo a usuarios con alguno de los roles indicados. Debe ir después de AuthRequired
+func RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+			c.Abort()
+			return
+		}
+
+		if !slices.Contains(roles, user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permisos para realizar esta acción"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasPermission indica si el rol del usuario concede el permiso (ver auth.RolePermissions)
+func HasPermission(user *models.User, permission string) bool {
+	return user != nil && slices.Contains(auth.RolePermissions[string(user.Role)], permission)
+}
+
+// RequirePermission permite el paso solo si el rol del usuario concede el permiso indicado
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+			c.Abort()
+			return
+		}
+
+		if !HasPermission(user, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permisos para realizar esta acción"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
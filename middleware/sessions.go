@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"NovelUzu/constants/auth"
+	models "NovelUzu/models/postgres"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sessionCacheTTL limita cuánto tiempo se confía en el estado cacheado de una sesión.
+// Las revocaciones hechas en este proceso invalidan la caché al momento
+const (
+	sessionCacheTTL        = 30 * time.Second
+	sessionCacheMaxEntries = 10000
+)
+
+// sessionTouchInterval es la frecuencia máxima con la que se guarda last_seen_at de una sesión
+const sessionTouchInterval = time.Minute
+
+type sessionCacheEntry struct {
+	email     string
+	active    bool
+	checkedAt time.Time
+}
+
+var sessionCache = struct {
+	sync.RWMutex
+	entries map[uint]sessionCacheEntry
+}{entries: make(map[uint]sessionCacheEntry)}
+
+// isSessionActive comprueba (con caché) que la sesión existe, pertenece al usuario y no ha sido revocada
+func isSessionActive(db *gorm.DB, sessionID uint, email string) (bool, error) {
+	sessionCache.RLock()
+	entry, found := sessionCache.entries[sessionID]
+	sessionCache.RUnlock()
+	if found && time.Since(entry.checkedAt) < sessionCacheTTL {
+		return entry.active && entry.email == email, nil
+	}
+
+	var session models.UserSession
+	err := db.Where("id = ?", sessionID).First(&session).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return false, err
+	}
+	active := err == nil && session.IsActive()
+
+	sessionCache.Lock()
+	if len(sessionCache.entries) >= sessionCacheMaxEntries {
+		pruneSessionCache()
+	}
+	sessionCache.entries[sessionID] = sessionCacheEntry{
+		email:     session.UserEmail,
+		active:    active,
+		checkedAt: time.Now(),
+	}
+	sessionCache.Unlock()
+
+	return active && session.UserEmail == email, nil
+}
+
+// pruneSessionCache elimina las entradas caducadas. Se llama con el lock tomado
+func pruneSessionCache() {
+	for id, entry := range sessionCache.entries {
+		if time.Since(entry.checkedAt) >= sessionCacheTTL {
+			delete(sessionCache.entries, id)
+		}
+	}
+	// Si todas siguen vigentes se vacía la caché antes que crecer sin límite
+	if len(sessionCache.entries) >= sessionCacheMaxEntries {
+		sessionCache.entries = make(map[uint]sessionCacheEntry)
+	}
+}
+
+var recentTouches = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+// shouldTouch indica si ha pasado sessionTouchInterval desde la última vez que se registró
+// actividad para la clave en este proceso, y en ese caso anota la actual
+func shouldTouch(key string, now time.Time) bool {
+	recentTouches.Lock()
+	defer recentTouches.Unlock()
+
+	if last, found := recentTouches.last[key]; found && now.Sub(last) < sessionTouchInterval {
+		return false
+	}
+	if len(recentTouches.last) >= sessionCacheMaxEntries {
+		for k, last := range recentTouches.last {
+			if now.Sub(last) >= sessionTouchInterval {
+				delete(recentTouches.last, k)
+			}
+		}
+	}
+	recentTouches.last[key] = now
+	return true
+}
+
+// touchSession actualiza last_seen_at de la sesión, como mucho una vez por sessionTouchInterval
+func touchSession(db *gorm.DB, sessionID uint) {
+	now := time.Now()
+	if !shouldTouch(fmt.Sprintf("session:%d", sessionID), now) {
+		return
+	}
+
+	// La condición evita escrituras redundantes cuando hay varias instancias de la API
+	err := db.Model(&models.UserSession{}).
+		Where("id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)", sessionID, now.Add(-sessionTouchInterval)).
+		Update("last_seen_at", now).Error
+	if err != nil {
+		fmt.Printf("Error al actualizar la actividad de la sesión %d: %v\n", sessionID, err)
+	}
+}
+
+// forgetSessions invalida las entradas de caché de las sesiones indicadas
+func forgetSessions(ids ...uint) {
+	sessionCache.Lock()
+	for _, id := range ids {
+		delete(sessionCache.entries, id)
+	}
+	sessionCache.Unlock()
+}
+
+// forgetUserSessions invalida todas las entradas de caché de un usuario
+func forgetUserSessions(email string) {
+	sessionCache.Lock()
+	for id, entry := range sessionCache.entries {
+		if entry.email == email {
+			delete(sessionCache.entries, id)
+		}
+	}
+	sessionCache.Unlock()
+}
+
+// RevokeSession revoca una sesión concreta. Sus tokens de acceso dejan de aceptarse inmediatamente
+func RevokeSession(db *gorm.DB, sessionID uint) error {
+	err := db.Model(&models.UserSession{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+	forgetSessions(sessionID)
+	return err
+}
+
+// RevokeUserSessions revoca todas las sesiones de un usuario salvo, opcionalmente, exceptSessionID (0 para ninguna)
+func RevokeUserSessions(db *gorm.DB, email string, exceptSessionID uint) error {
+	query := db.Model(&models.UserSession{}).Where("user_email = ? AND revoked_at IS NULL", email)
+	if exceptSessionID != 0 {
+		query = query.Where("id <> ?", exceptSessionID)
+	}
+	err := query.Update("revoked_at", time.Now()).Error
+	forgetUserSessions(email)
+	return err
+}
+
+// CurrentSessionID devuelve el id de la sesión del token con el que se autenticó la petición
+func CurrentSessionID(c *gin.Context) uint {
+	return c.GetUint(auth.ContextSessionID)
+}
+
+// SessionActive indica si la sesión sigue abierta. Lo usan las conexiones de larga duración
+// (Socket.IO), que solo pasan por AuthenticateSocket al conectarse
+func SessionActive(db *gorm.DB, sessionID uint, email string) (bool, error) {
+	return isSessionActive(db, sessionID, email)
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"log"
 	"os"
 
 	"github.com/gin-contrib/cors"
@@ -10,7 +11,14 @@ import (
 )
 
 func SetUpMiddleware(r *gin.Engine) {
-	key := os.Getenv("KEY")
+	// La cookie de sesión usa su propio secreto, que no puede coincidir con el de los JWT
+	key := os.Getenv("SESSION_SECRET")
+	if key == "" {
+		log.Fatalf("Es necesario definir SESSION_SECRET")
+	}
+	if key == os.Getenv("JWT_SECRET") {
+		log.Fatalf("SESSION_SECRET y JWT_SECRET deben ser distintos")
+	}
 	store := cookie.NewStore(([]byte(key)))
 
 	r.Use(sessions.Sessions("mysession", store))
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	models "NovelUzu/models/postgres"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Códigos de error devueltos cuando el estado de la cuenta no permite el acceso
+const (
+	CodeAccountBanned    = "account_banned"
+	CodeAccountSuspended = "account_suspended"
+	CodeAccountInactive  = "account_inactive"
+)
+
+// AccountStatusError describe por qué una cuenta no puede acceder
+type AccountStatusError struct {
+	Code    string
+	Message string
+	Until   *time.Time
+	Reason  *string
+}
+
+// CheckAccountStatus comprueba si el usuario puede acceder según su estado. Las suspensiones
+// vencidas se levantan automáticamente, actualizando tanto la base de datos como user
+func CheckAccountStatus(db *gorm.DB, user *models.User) (*AccountStatusError, error) {
+	switch user.Status {
+	case models.UserStatusBaneado:
+		return &AccountStatusError{
+			Code:    CodeAccountBanned,
+			Message: "La cuenta ha sido baneada",
+			Reason:  user.SuspensionReason,
+		}, nil
+	case models.UserStatusInactivo:
+		return &AccountStatusError{
+			Code:    CodeAccountInactive,
+			Message: "La cuenta está inactiva",
+		}, nil
+	case models.UserStatusSuspendido:
+		// Sin fecha de fin la suspensión es indefinida
+		if user.SuspendedUntil == nil || time.Now().Before(*user.SuspendedUntil) {
+			return &AccountStatusError{
+				Code:    CodeAccountSuspended,
+				Message: "La cuenta está suspendida",
+				Until:   user.SuspendedUntil,
+				Reason:  user.SuspensionReason,
+			}, nil
+		}
+
+		// La suspensión ha vencido: reactivar la cuenta
+		if err := db.Model(user).Updates(map[string]interface{}{
+			"status":            models.UserStatusActivo,
+			"suspended_until":   nil,
+			"suspension_reason": nil,
+			"updated_at":        time.Now(),
+		}).Error; err != nil {
+			return nil, err
+		}
+		user.Status = models.UserStatusActivo
+		user.SuspendedUntil = nil
+		user.SuspensionReason = nil
+	}
+	return nil, nil
+}
+
+// RespondAccountStatus escribe la respuesta 403 correspondiente a un AccountStatusError
+func RespondAccountStatus(c *gin.Context, statusErr *AccountStatusError) {
+	body := gin.H{
+		"error": statusErr.Message,
+		"code":  statusErr.Code,
+	}
+	if statusErr.Until != nil {
+		body["suspended_until"] = statusErr.Until.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if statusErr.Reason != nil {
+		body["reason"] = *statusErr.Reason
+	}
+	c.JSON(http.StatusForbidden, body)
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+
+	models "NovelUzu/models/postgres"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CodeTwoFactorRequired se devuelve cuando el rol del usuario exige 2FA y no la tiene activada
+const CodeTwoFactorRequired = "two_factor_required"
+
+// TwoFactorRequired indica si el rol del usuario obliga a usar 2FA (REQUIRE_ADMIN_2FA=true para administradores)
+func TwoFactorRequired(user *models.User) bool {
+	return user.Role == models.UserRoleAdmin && os.Getenv("REQUIRE_ADMIN_2FA") == "true"
+}
+
+// RequireTwoFactor bloquea a los usuarios cuyo rol exige 2FA y aún no la han activado. Debe ir después de AuthRequired
+func RequireTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+			c.Abort()
+			return
+		}
+
+		if TwoFactorRequired(user) && !user.TOTPEnabled {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Debes activar la verificación en dos pasos para acceder a esta sección",
+				"code":  CodeTwoFactorRequired,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
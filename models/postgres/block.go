@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// BlockKind represents how strongly a user hides another one
+type BlockKind string
+
+const (
+	// BlockKindBlock stops the other user from following, commenting on the novels of, replying
+	// to or seeing the profile of the user
+	BlockKindBlock BlockKind = "bloqueo"
+	// BlockKindMute only hides the other user's comments and activity from the user's views
+	BlockKindMute BlockKind = "silencio"
+)
+
+// Value implements the driver.Valuer interface for BlockKind
+func (bk BlockKind) Value() (driver.Value, error) {
+	return string(bk), nil
+}
+
+/*
+ * 'UserBlock' records that UserEmail blocked or muted BlockedEmail. There is at most one row per
+ * pair: blocking someone already muted turns the mute into a block
+ */
+type UserBlock struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserEmail    string    `gorm:"column:user_email;size:255;not null;uniqueIndex:idx_user_blocks_pair,priority:1"`
+	User         User      `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	BlockedEmail string    `gorm:"column:blocked_email;size:255;not null;uniqueIndex:idx_user_blocks_pair,priority:2;index:idx_user_blocks_blocked"`
+	Blocked      User      `gorm:"foreignKey:BlockedEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Kind         BlockKind `gorm:"type:varchar(20);not null"`
+	CreatedAt    time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// DataExportStatus represents the state of a personal data export
+type DataExportStatus string
+
+const (
+	DataExportPendiente  DataExportStatus = "pendiente"
+	DataExportProcesando DataExportStatus = "procesando"
+	DataExportListo      DataExportStatus = "listo"
+	DataExportError      DataExportStatus = "error"
+	DataExportCaducado   DataExportStatus = "caducado"
+)
+
+// Value implements the driver.Valuer interface for DataExportStatus
+func (ds DataExportStatus) Value() (driver.Value, error) {
+	return string(ds), nil
+}
+
+/*
+ * 'DataExport' is a ZIP archive with all the personal data of a user, built in the background.
+ * The file is downloaded with a link whose token is stored hashed (TokenHash) and stops
+ * working at ExpiresAt, when the file is removed
+ */
+type DataExport struct {
+	ID          uint             `gorm:"primaryKey"`
+	UserEmail   string           `gorm:"column:user_email;size:255;not null;index:idx_data_exports_user"`
+	User        User             `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Status      DataExportStatus `gorm:"type:varchar(20);not null;default:'pendiente'"`
+	FilePath    *string          `gorm:"column:file_path;type:text"`
+	FileSize    int64            `gorm:"column:file_size;default:0"`
+	TokenHash   *string          `gorm:"size:64;uniqueIndex:idx_data_exports_token"`
+	Error       *string          `gorm:"type:text"`
+	ExpiresAt   *time.Time       `gorm:"column:expires_at"`
+	CompletedAt *time.Time       `gorm:"column:completed_at"`
+	CreatedAt   time.Time        `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
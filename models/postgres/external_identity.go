@@ -0,0 +1,18 @@
+package postgres
+
+import "time"
+
+/*
+ * 'ExternalIdentity' links a User to an account on an external OpenID Connect provider.
+ * The pair (provider, subject) identifies the external account; a user can link at most
+ * one account per provider
+ */
+type ExternalIdentity struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserEmail string    `gorm:"column:user_email;size:255;not null;uniqueIndex:idx_external_identities_user_provider"`
+	User      User      `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Provider  string    `gorm:"size:50;not null;uniqueIndex:idx_external_identities_subject;uniqueIndex:idx_external_identities_user_provider"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_external_identities_subject"`
+	Email     *string   `gorm:"size:255"`
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
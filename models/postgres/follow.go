@@ -0,0 +1,16 @@
+package postgres
+
+import "time"
+
+/*
+ * 'UserFollow' is an edge of the follower graph: FollowerEmail follows FollowedEmail (usually an
+ * author). The activity feed reads the followed users' system_events through this table
+ */
+type UserFollow struct {
+	ID            uint      `gorm:"primaryKey"`
+	FollowerEmail string    `gorm:"column:follower_email;size:255;not null;uniqueIndex:idx_user_follows_pair,priority:1"`
+	Follower      User      `gorm:"foreignKey:FollowerEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	FollowedEmail string    `gorm:"column:followed_email;size:255;not null;uniqueIndex:idx_user_follows_pair,priority:2;index:idx_user_follows_followed"`
+	Followed      User      `gorm:"foreignKey:FollowedEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	CreatedAt     time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
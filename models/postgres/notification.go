@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// NotificationType represents the kind of a notification (notification_type SQL enum)
+type NotificationType string
+
+const (
+	NotificationNewChapter   NotificationType = "nuevo_capitulo"
+	NotificationCommentReply NotificationType = "respuesta_comentario"
+	NotificationNovelUpdate  NotificationType = "actualizacion_novela"
+	NotificationSystem       NotificationType = "sistema"
+	NotificationAchievement  NotificationType = "logro"
+)
+
+// Value implements the driver.Valuer interface for NotificationType
+func (nt NotificationType) Value() (driver.Value, error) {
+	return string(nt), nil
+}
+
+/*
+ * 'Notification' is a message for a user. It is stored so it can be read later and is also
+ * pushed live to the user's open connections. Data holds type-specific fields (novel, chapter...)
+ */
+type Notification struct {
+	ID        uint             `gorm:"primaryKey"`
+	UserEmail string           `gorm:"column:user_email;size:255;not null;index:idx_notifications_user"`
+	User      User             `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Type      NotificationType `gorm:"type:varchar(30);not null"`
+	Title     string           `gorm:"size:255;not null"`
+	Message   string           `gorm:"type:text;not null"`
+	Data      json.RawMessage  `gorm:"type:jsonb"`
+	IsRead    bool             `gorm:"column:is_read;default:false;index:idx_notifications_read"`
+	CreatedAt time.Time        `gorm:"column:created_at;default:CURRENT_TIMESTAMP;index:idx_notifications_created"`
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"strings"
+	"time"
+)
+
+/*
+ * 'PersonalAccessToken' lets a user give a third-party client API access without sharing the
+ * password. Only the SHA-256 hash of the token is stored; TokenPrefix keeps the first characters
+ * so the user can recognise it. Scopes is a space-separated list of auth.Scope* values
+ */
+type PersonalAccessToken struct {
+	ID          uint       `gorm:"primaryKey"`
+	UserEmail   string     `gorm:"column:user_email;size:255;not null;index:idx_personal_tokens_user"`
+	User        User       `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Name        string     `gorm:"size:100;not null"`
+	TokenHash   string     `gorm:"size:64;not null;uniqueIndex:idx_personal_tokens_hash"`
+	TokenPrefix string     `gorm:"size:16;not null"`
+	Scopes      string     `gorm:"type:text;not null;default:''"`
+	ExpiresAt   *time.Time `gorm:"column:expires_at"`
+	LastUsedAt  *time.Time `gorm:"column:last_used_at"`
+	LastUsedIP  *string    `gorm:"column:last_used_ip;size:45"`
+	RevokedAt   *time.Time `gorm:"column:revoked_at"`
+	CreatedAt   time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
+
+// ScopeList returns the scopes granted to the token
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// IsActive reports whether the token can still be used
+func (t *PersonalAccessToken) IsActive() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt))
+}
@@ -0,0 +1,40 @@
+package postgres
+
+import "time"
+
+/*
+ * 'UserPrivacySettings' controls which sections of the public profile (GET /users/:username)
+ * other people can see. Users without a row use DefaultPrivacySettings (everything visible).
+ * The email is never part of the public profile, so it has no setting
+ */
+type UserPrivacySettings struct {
+	UserEmail        string    `gorm:"column:user_email;primaryKey;size:255"`
+	User             User      `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	ShowBio          bool      `gorm:"column:show_bio;not null"`
+	ShowCountry      bool      `gorm:"column:show_country;not null"`
+	ShowJoinDate     bool      `gorm:"column:show_join_date;not null"`
+	ShowNovels       bool      `gorm:"column:show_novels;not null"`
+	ShowLibrary      bool      `gorm:"column:show_library;not null"`
+	ShowAchievements bool      `gorm:"column:show_achievements;not null"`
+	ShowStats        bool      `gorm:"column:show_stats;not null"`
+	UpdatedAt        time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP"`
+}
+
+// TableName keeps the plural table name used in database.sql
+func (UserPrivacySettings) TableName() string {
+	return "user_privacy_settings"
+}
+
+// DefaultPrivacySettings returns the settings of a user that has never changed them
+func DefaultPrivacySettings(email string) UserPrivacySettings {
+	return UserPrivacySettings{
+		UserEmail:        email,
+		ShowBio:          true,
+		ShowCountry:      true,
+		ShowJoinDate:     true,
+		ShowNovels:       true,
+		ShowLibrary:      true,
+		ShowAchievements: true,
+		ShowStats:        true,
+	}
+}
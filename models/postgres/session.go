@@ -0,0 +1,38 @@
+package postgres
+
+import "time"
+
+/*
+ * 'UserSession' represents a login of a user on a device. SessionToken stores the
+ * SHA-256 hash of the current refresh token, which is rotated on every refresh.
+ * ImpersonatorEmail is set when an admin opened the session to impersonate the user
+ */
+type UserSession struct {
+	ID                uint       `gorm:"primaryKey"`
+	UserEmail         string     `gorm:"column:user_email;size:255;not null;index:idx_user_sessions_user"`
+	User              User       `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	SessionToken      string     `gorm:"size:255;not null;uniqueIndex:idx_user_sessions_token"`
+	IPAddress         *string    `gorm:"column:ip_address;size:45"`
+	UserAgent         *string    `gorm:"type:text"`
+	ExpiresAt         time.Time  `gorm:"column:expires_at;not null"`
+	RevokedAt         *time.Time `gorm:"column:revoked_at"`
+	LastSeenAt        *time.Time `gorm:"column:last_seen_at"`
+	ImpersonatorEmail *string    `gorm:"column:impersonator_email;size:255"`
+	CreatedAt         time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
+
+// IsActive reports whether the session can still be used to refresh tokens
+func (s *UserSession) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+/*
+ * 'SpentRefreshToken' records the SHA-256 hash of every refresh token a session rotated away
+ * from. Presenting any of them again means the token was copied, so the session is revoked
+ */
+type SpentRefreshToken struct {
+	TokenHash string      `gorm:"column:token_hash;size:64;primaryKey"`
+	SessionID uint        `gorm:"column:session_id;not null;index:idx_spent_refresh_tokens_session"`
+	Session   UserSession `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE"`
+	SpentAt   time.Time   `gorm:"column:spent_at;default:CURRENT_TIMESTAMP"`
+}
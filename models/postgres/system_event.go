@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types stored in system_events
+const (
+	EventImpersonationStarted = "impersonation_started"
+	EventImpersonationRequest = "impersonation_request"
+	EventImpersonationEnded   = "impersonation_ended"
+	// Author activity, shown in the feed of their followers
+	EventNovelPublished     = "novel_published"
+	EventChapterPublished   = "chapter_published"
+	EventAuthorAnnouncement = "author_announcement"
+)
+
+// FeedEventTypes are the events shown in the activity feed of the author's followers
+var FeedEventTypes = []string{EventNovelPublished, EventChapterPublished, EventAuthorAnnouncement}
+
+/*
+ * 'SystemEvent' is an append-only record of something that happened on the platform (audit
+ * trail, activity). UserEmail is the user the event is about; Data holds event-specific fields
+ */
+type SystemEvent struct {
+	ID        uint            `gorm:"primaryKey;index:idx_system_events_feed,priority:2"`
+	EventType string          `gorm:"column:event_type;size:50;not null;index:idx_system_events_type"`
+	UserEmail *string         `gorm:"column:user_email;size:255;index:idx_system_events_user;index:idx_system_events_feed,priority:1"`
+	User      *User           `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	NovelID   *uint           `gorm:"column:novel_id"`
+	ChapterID *uint           `gorm:"column:chapter_id"`
+	Data      json.RawMessage `gorm:"type:jsonb"`
+	IPAddress *string         `gorm:"column:ip_address;size:45"`
+	UserAgent *string         `gorm:"type:text"`
+	CreatedAt time.Time       `gorm:"column:created_at;default:CURRENT_TIMESTAMP;index:idx_system_events_created"`
+}
@@ -0,0 +1,16 @@
+package postgres
+
+import "time"
+
+/*
+ * 'RecoveryCode' is a one-time code that replaces the TOTP code when the user has lost
+ * the authenticator. Only the SHA-256 hash of the code is stored
+ */
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserEmail string     `gorm:"column:user_email;size:255;not null;index:idx_recovery_codes_user"`
+	User      User       `gorm:"foreignKey:UserEmail;references:Email;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	CodeHash  string     `gorm:"size:64;not null"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
+	CreatedAt time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+}
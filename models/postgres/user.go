@@ -2,7 +2,10 @@ package postgres
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // UserRole represents the role of a user
@@ -17,11 +20,21 @@ const (
 type UserStatus string
 
 const (
-	UserStatusActivo   UserStatus = "activo"
-	UserStatusInactivo UserStatus = "inactivo"
-	UserStatusBaneado  UserStatus = "baneado"
+	UserStatusActivo     UserStatus = "activo"
+	UserStatusInactivo   UserStatus = "inactivo"
+	UserStatusSuspendido UserStatus = "suspendido"
+	UserStatusBaneado    UserStatus = "baneado"
 )
 
+// IsValid reports whether the status is one of the values of the user_status SQL enum
+func (us UserStatus) IsValid() bool {
+	switch us {
+	case UserStatusActivo, UserStatusInactivo, UserStatusSuspendido, UserStatusBaneado:
+		return true
+	}
+	return false
+}
+
 // Value implements the driver.Valuer interface for UserRole
 func (ur UserRole) Value() (driver.Value, error) {
 	return string(ur), nil
@@ -33,23 +46,39 @@ func (us UserStatus) Value() (driver.Value, error) {
 }
 
 /*
- * 'User' contains the blueprint definition of a User. It contains a reference to GameProfile
+ * 'User' contains the blueprint definition of a User. It contains a reference to GameProfile.
+ * Deleted accounts are kept anonymized so authored content survives; DeletedAt hides them from queries.
+ * AvatarVariants maps each avatar size to the URL of every format ({"64": {"webp": ..., "jpeg": ...}})
+ * AvatarKeys lists the storage keys of those files, space separated, so they can be deleted later
  */
 type User struct {
-	Email                  string     `gorm:"primaryKey;size:255;not null;index:idx_users_email"`
-	ProfileUsername        string     `gorm:"column:username;size:50;not null;uniqueIndex:idx_users_profile_username"`
-	PasswordHash           string     `gorm:"size:255;not null"`
-	Role                   UserRole   `gorm:"type:varchar(20);default:'usuario'"`
-	Status                 UserStatus `gorm:"type:varchar(20);default:'activo'"`
-	AvatarURL              *string    `gorm:"column:avatar_url;type:text"`
-	Bio                    *string    `gorm:"type:text"`
-	BirthDate              *time.Time `gorm:"column:birth_date;type:date"`
-	Country                *string    `gorm:"size:100"`
-	EmailVerified          bool       `gorm:"default:false"`
-	EmailVerificationToken *string    `gorm:"size:255"`
-	PasswordResetToken     *string    `gorm:"size:255"`
-	PasswordResetExpires   *time.Time `gorm:"column:password_reset_expires"`
-	LastLogin              *time.Time `gorm:"column:last_login"`
-	CreatedAt              time.Time  `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
-	UpdatedAt              time.Time  `gorm:"column:updated_at;default:CURRENT_TIMESTAMP"`
+	Email                    string          `gorm:"primaryKey;size:255;not null;index:idx_users_email"`
+	ProfileUsername          string          `gorm:"column:username;size:50;not null;uniqueIndex:idx_users_profile_username"`
+	PasswordHash             string          `gorm:"size:255;not null"`
+	Role                     UserRole        `gorm:"type:varchar(20);default:'usuario'"`
+	Status                   UserStatus      `gorm:"type:varchar(20);default:'activo'"`
+	SuspendedUntil           *time.Time      `gorm:"column:suspended_until"`
+	SuspensionReason         *string         `gorm:"type:text"`
+	AvatarURL                *string         `gorm:"column:avatar_url;type:text"`
+	AvatarVariants           json.RawMessage `gorm:"column:avatar_variants;type:jsonb"`
+	AvatarKeys               string          `gorm:"column:avatar_keys;type:text;default:''"`
+	Bio                      *string         `gorm:"type:text"`
+	BirthDate                *time.Time      `gorm:"column:birth_date;type:date"`
+	Country                  *string         `gorm:"size:100"`
+	EmailVerified            bool            `gorm:"default:false"`
+	EmailVerificationToken   *string         `gorm:"size:255"`
+	EmailVerificationExpires *time.Time      `gorm:"column:email_verification_expires"`
+	PasswordResetToken       *string         `gorm:"size:255"`
+	PasswordResetExpires     *time.Time      `gorm:"column:password_reset_expires"`
+	PendingEmail             *string         `gorm:"column:pending_email;size:255"`
+	EmailChangeToken         *string         `gorm:"size:255"`
+	EmailChangeExpires       *time.Time      `gorm:"column:email_change_expires"`
+	TOTPSecret               *string         `gorm:"column:totp_secret;size:64"`
+	TOTPEnabled              bool            `gorm:"column:totp_enabled;default:false"`
+	TOTPLastCounter          int64           `gorm:"column:totp_last_counter;default:0"`
+	LastLogin                *time.Time      `gorm:"column:last_login"`
+	DeletionScheduledAt      *time.Time      `gorm:"column:deletion_scheduled_at;index:idx_users_deletion_scheduled"`
+	CreatedAt                time.Time       `gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
+	UpdatedAt                time.Time       `gorm:"column:updated_at;default:CURRENT_TIMESTAMP"`
+	DeletedAt                gorm.DeletedAt  `gorm:"column:deleted_at;index:idx_users_deleted_at"`
 }
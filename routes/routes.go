@@ -1,9 +1,18 @@
 package routes
 
 import (
+	authconst "NovelUzu/constants/auth"
 	"NovelUzu/controllers"
 	"NovelUzu/middleware"
+	models "NovelUzu/models/postgres"
 	utils "NovelUzu/utils"
+	"NovelUzu/utils/mailer"
+	"NovelUzu/utils/oidc"
+	"NovelUzu/utils/ratelimit"
+	"NovelUzu/utils/realtime"
+	"NovelUzu/utils/storage"
+	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -18,30 +27,177 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB) {
 	// utils global
 	router.Use(utils.ErrorHandler())
 
+	// Claves de firma de los JWT (JWT_KEYS_DIR o, en su defecto, un secreto HS256)
+	if _, err := middleware.SigningKeys(); err != nil {
+		log.Fatalf("Error cargando las claves de firma de JWT: %v", err)
+	}
+
+	// Correo saliente (SMTP u outbox en disco según MAILER_DRIVER)
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatalf("Error configurando el envío de correo: %v", err)
+	}
+
+	// Almacenamiento de archivos subidos (Nextcloud, disco local o S3 según STORAGE_DRIVER)
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("Error configurando el almacenamiento de archivos: %v", err)
+	}
+	if local, ok := store.(*storage.LocalStorage); ok {
+		router.Static(local.Route(), local.Dir)
+	}
+
+	// Proveedores externos de inicio de sesión (OpenID Connect) definidos en OIDC_PROVIDERS
+	oidcProviders, err := oidc.ProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Error configurando los proveedores OIDC: %v", err)
+	}
+
+	// Limitación de peticiones y bloqueo por fuerza bruta (en memoria o Redis según RATE_LIMIT_STORE)
+	limitStore, err := ratelimit.NewStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Error configurando el limitador de peticiones: %v", err)
+	}
+	loginGuard := ratelimit.NewLoginGuard(limitStore)
+	loginLimit := middleware.RateLimit(ratelimit.NewLimiter(limitStore, "login",
+		ratelimit.RateFromEnv("RATE_LIMIT_LOGIN", ratelimit.Rate{Limit: 10, Window: time.Minute})), middleware.KeyByIP)
+	signupLimit := middleware.RateLimit(ratelimit.NewLimiter(limitStore, "signup",
+		ratelimit.RateFromEnv("RATE_LIMIT_SIGNUP", ratelimit.Rate{Limit: 5, Window: time.Hour})), middleware.KeyByIP)
+	emailLimit := middleware.RateLimit(ratelimit.NewLimiter(limitStore, "email",
+		ratelimit.RateFromEnv("RATE_LIMIT_EMAIL", ratelimit.Rate{Limit: 5, Window: time.Hour})), middleware.KeyByIP)
+
+	// Borrado definitivo de las cuentas cuyo periodo de gracia ha terminado
+	controllers.StartAccountPurger(db, mail, store)
+	controllers.StartDataExportCleaner(db)
+
+	// Eventos en tiempo real (Socket.IO): notificaciones, capítulos nuevos y respuestas a comentarios
+	hub := realtime.NewHub()
+	gateway := realtime.NewGateway(hub, controllers.SocketAuthenticator(db))
+	router.Any("/socket.io/*any", gin.WrapH(gateway.Handler()))
+
 	// Swagger route
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Claves públicas para que otros servicios verifiquen nuestros tokens
+	router.GET("/.well-known/jwks.json", controllers.JWKS())
+
 	// Testing a basic endpoint, and the auto-docs
 
 	// API routes group
 	api := router.Group("/")
-	api.POST("/login", controllers.Login(db))
-	api.POST("/signup", controllers.SignUp(db))
+	api.POST("/login", loginLimit, controllers.Login(db, loginGuard))
+	api.POST("/login/2fa", loginLimit, controllers.LoginTwoFactor(db, loginGuard))
+	api.POST("/signup", signupLimit, controllers.SignUp(db, mail))
+	api.POST("/verify-email", loginLimit, controllers.VerifyEmail(db))
+	api.POST("/email/confirm", loginLimit, controllers.ConfirmEmailChange(db))
+	api.GET("/password/policy", controllers.PasswordPolicy())
+	api.POST("/password/forgot", emailLimit, controllers.ForgotPassword(db, mail))
+	api.POST("/password/reset", loginLimit, controllers.ResetPassword(db))
+	api.GET("/exports/download", loginLimit, controllers.DownloadDataExportByToken(db))
+	// Perfiles públicos. Sin token se ven como cualquier visitante (solo lo que la privacidad del
+	// dueño permite); el bloqueo solo oculta el perfil a quien lo consulta con su cuenta
+	api.GET("/users/:username", middleware.AllowPersonalTokens(authconst.ScopeUsersRead), middleware.OptionalAuth(db), controllers.GetPublicProfile(db))
+	api.GET("/users/:username/followers", middleware.AllowPersonalTokens(authconst.ScopeUsersRead), middleware.OptionalAuth(db), controllers.ListFollowers(db))
+	api.GET("/users/:username/following", middleware.AllowPersonalTokens(authconst.ScopeUsersRead), middleware.OptionalAuth(db), controllers.ListFollowing(db))
+	// El refresh no pasa por AuthRequired: el token de acceso puede haber expirado ya
+	api.POST("/auth/refresh", loginLimit, controllers.RefreshToken(db))
+
+	// Inicio de sesión con proveedores externos
+	api.GET("/auth/oidc/providers", controllers.OIDCProviders(oidcProviders))
+	api.GET("/auth/oidc/:provider/login", loginLimit, controllers.OIDCLogin(oidcProviders))
+	api.GET("/auth/oidc/:provider/callback", loginLimit, controllers.OIDCCallback(db, oidcProviders))
+
+	// Rutas autenticadas. Solo admiten tokens de acceso personal las que declaran su ámbito con
+	// AllowPersonalTokens antes de AuthRequired; las de gestión de la cuenta exigen además una
+	// sesión iniciada con RequireSession
+	api.GET("/auth/verify-token", middleware.AllowPersonalTokens(authconst.ScopeProfileRead), middleware.AuthRequired(db), controllers.VerifyTokenAndGetUser(db))
 
-	// Rutas autenticadas
 	auth := api.Group("/auth")
-	auth.Use(middleware.AuthRequired)
+	auth.Use(middleware.AuthRequired(db))
 	{
-		auth.DELETE("/logout", controllers.Logout)
-		auth.GET("/verify-token", controllers.VerifyTokenAndGetUser(db))
+		auth.DELETE("/logout", middleware.RequireSession(), controllers.Logout(db))
+		auth.DELETE("/logout-all", middleware.RequireSession(), middleware.BlockImpersonation(), controllers.LogoutAll(db))
+		auth.POST("/resend-verification", middleware.RequireSession(), middleware.BlockImpersonation(), emailLimit, controllers.ResendVerification(db, mail))
 	}
 
 	user := api.Group("/user")
-	user.Use(middleware.AuthRequired)
+
+	usersRead := user.Group("", middleware.AllowPersonalTokens(authconst.ScopeUsersRead), middleware.AuthRequired(db))
+	{
+		usersRead.GET("/allusers", controllers.GetAllUsers(db))
+	}
+
+	profileRead := user.Group("", middleware.AllowPersonalTokens(authconst.ScopeProfileRead), middleware.AuthRequired(db))
+	{
+		profileRead.GET("/privacy", controllers.GetPrivacySettings(db))
+		profileRead.GET("/blocks", controllers.ListBlocks(db))
+		profileRead.GET("/feed", controllers.GetFeed(db))
+	}
+
+	profileWrite := user.Group("", middleware.AllowPersonalTokens(authconst.ScopeProfileWrite), middleware.AuthRequired(db))
+	{
+		profileWrite.PUT("/update", controllers.UpdateProfile(db, store))
+		profileWrite.PUT("/privacy", controllers.UpdatePrivacySettings(db))
+		profileWrite.POST("/follows/:username", controllers.FollowUser(db))
+		profileWrite.DELETE("/follows/:username", controllers.UnfollowUser(db))
+		profileWrite.POST("/blocks/:username", controllers.BlockUser(db))
+		profileWrite.DELETE("/blocks/:username", controllers.UnblockUser(db))
+		profileWrite.POST("/mutes/:username", controllers.MuteUser(db))
+		profileWrite.DELETE("/mutes/:username", controllers.UnmuteUser(db))
+	}
+
+	novelsWrite := user.Group("", middleware.AllowPersonalTokens(authconst.ScopeNovelsWrite), middleware.AuthRequired(db))
+	{
+		novelsWrite.POST("/announcements", middleware.RequireVerifiedEmail(authconst.ActionPublish), controllers.PostAnnouncement(db))
+	}
+
+	// La gestión de la cuenta solo la hace su dueño, nunca un administrador que lo suplanta
+	account := user.Group("", middleware.AuthRequired(db), middleware.RequireSession(), middleware.BlockImpersonation())
+	{
+		account.PUT("/change-password", controllers.ChangePassword(db))
+		account.POST("/email", emailLimit, controllers.RequestEmailChange(db, mail))
+		account.DELETE("/email", controllers.CancelEmailChange(db))
+		account.DELETE("/delete-account", controllers.DeleteAccount(db, mail))
+
+		// Copia de los datos personales (RGPD)
+		account.POST("/exports", emailLimit, controllers.RequestDataExport(db, hub, mail, store))
+		account.GET("/exports", controllers.ListDataExports(db))
+		account.GET("/exports/:id/download", controllers.DownloadDataExport(db))
+
+		// Sesiones abiertas en otros dispositivos
+		account.GET("/sessions", controllers.ListSessions(db))
+		account.DELETE("/sessions", controllers.RevokeOtherSessions(db))
+		account.DELETE("/sessions/:id", controllers.RevokeUserSession(db))
+
+		// Tokens de acceso personal para aplicaciones de terceros
+		account.GET("/tokens", controllers.ListPersonalTokens(db))
+		account.POST("/tokens", controllers.CreatePersonalToken(db))
+		account.DELETE("/tokens/:id", controllers.RevokePersonalToken(db))
+
+		// Verificación en dos pasos (TOTP)
+		account.POST("/2fa/setup", controllers.SetupTwoFactor(db))
+		account.POST("/2fa/confirm", controllers.ConfirmTwoFactor(db, loginGuard))
+		account.DELETE("/2fa", controllers.DisableTwoFactor(db, loginGuard))
+		account.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes(db, loginGuard))
+
+		// Cuentas externas vinculadas (OIDC)
+		account.GET("/identities", controllers.ListExternalIdentities(db, oidcProviders))
+		account.POST("/identities/:provider", controllers.LinkExternalIdentity(oidcProviders))
+		account.DELETE("/identities/:provider", controllers.UnlinkExternalIdentity(db))
+
+		// Notificaciones (también se reciben en directo por Socket.IO)
+		account.GET("/notifications", controllers.ListNotifications(db))
+		account.PUT("/notifications/read-all", controllers.MarkAllNotificationsRead(db))
+		account.PUT("/notifications/:id/read", controllers.MarkNotificationRead(db))
+	}
+
+	// Rutas de administración
+	admin := api.Group("/admin")
+	admin.Use(middleware.AuthRequired(db), middleware.RequireSession(), middleware.BlockImpersonation(), middleware.RequireRole(models.UserRoleAdmin), middleware.RequireTwoFactor())
 	{
-		user.GET("/allusers", controllers.GetAllUsers(db))
-		user.PUT("/update", controllers.UpdateProfile(db))
-		user.PUT("/change-password", controllers.ChangePassword(db))
-		user.DELETE("/delete-account", controllers.DeleteAccount(db))
+		admin.GET("/users", middleware.RequirePermission(authconst.PermissionManageUsers), controllers.ListUsers(db))
+		admin.POST("/users/:username/impersonate", middleware.RequirePermission(authconst.PermissionImpersonate), controllers.StartImpersonation(db))
+		admin.PUT("/users/:username/role", middleware.RequirePermission(authconst.PermissionManageRoles), controllers.UpdateUserRole(db, hub))
+		admin.PUT("/users/:username/status", middleware.RequirePermission(authconst.PermissionManageUsers), controllers.UpdateUserStatus(db))
 	}
 }
@@ -0,0 +1,107 @@
+package images
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// jpegOrientation lee la etiqueta Orientation (0x0112) del bloque EXIF de un JPEG. Devuelve 1
+// (sin girar) si no hay EXIF o no se puede leer. Al volver a codificar la imagen se pierde el
+// EXIF, así que el giro que indicaba hay que aplicarlo a los píxeles
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// Los segmentos de datos de la imagen empiezan en SOS: ya no hay más metadatos
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation busca la orientación en el primer IFD de una cabecera TIFF
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset : offset+2]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if value < 1 || value > 8 {
+				return 1
+			}
+			return value
+		}
+	}
+	return 1
+}
+
+// orient aplica a una imagen cuadrada el giro o volteo de la orientación EXIF (2 a 8)
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	n := img.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, n, n))
+	last := n - 1
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			// (dx, dy) es donde acaba el píxel (x, y) una vez corregida la orientación
+			var dx, dy int
+			switch orientation {
+			case 2: // volteo horizontal
+				dx, dy = last-x, y
+			case 3: // giro de 180°
+				dx, dy = last-x, last-y
+			case 4: // volteo vertical
+				dx, dy = x, last-y
+			case 5: // trasposición
+				dx, dy = y, x
+			case 6: // giro de 90° en sentido horario
+				dx, dy = last-y, x
+			case 7: // trasposición inversa
+				dx, dy = last-y, last-x
+			case 8: // giro de 90° en sentido antihorario
+				dx, dy = y, last-x
+			}
+			dst.SetRGBA(dx, dy, img.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
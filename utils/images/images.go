@@ -0,0 +1,208 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	// Decodificadores que acepta Decode
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/HugoSmits86/nativewebp"
+	xdraw "golang.org/x/image/draw"
+)
+
+var (
+	ErrTooLarge          = errors.New("la imagen supera el tamaño máximo permitido")
+	ErrUnsupportedFormat = errors.New("formato de imagen no soportado (usa JPEG, PNG, GIF o WebP)")
+	ErrDimensions        = errors.New("las dimensiones de la imagen no son válidas")
+	ErrCorrupt           = errors.New("la imagen está dañada o no se puede leer")
+)
+
+// contentTypes son los tipos detectados por el contenido (no por la cabecera del cliente) que se aceptan
+var contentTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Limits acota lo que se acepta antes de decodificar. MaxPixels protege de las bombas de
+// descompresión: un PNG de pocos KB puede declarar 50000x50000 píxeles y ocupar gigas al decodificarse
+type Limits struct {
+	MaxBytes  int64
+	MaxSide   int
+	MinSide   int
+	MaxPixels int
+}
+
+// AvatarLimits son los límites de las imágenes de avatar
+var AvatarLimits = Limits{
+	MaxBytes:  5 * 1024 * 1024,
+	MaxSide:   8000,
+	MinSide:   32,
+	MaxPixels: 25_000_000,
+}
+
+// AvatarSizes son los lados, en píxeles, de las versiones cuadradas de cada avatar
+var AvatarSizes = []int{64, 128, 256}
+
+// OutputFormat es un formato en el que se vuelven a codificar las imágenes
+type OutputFormat string
+
+const (
+	FormatJPEG OutputFormat = "jpeg"
+	FormatWebP OutputFormat = "webp"
+)
+
+// Ext devuelve la extensión de archivo del formato
+func (f OutputFormat) Ext() string {
+	if f == FormatWebP {
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+// ContentType devuelve el tipo MIME del formato
+func (f OutputFormat) ContentType() string {
+	return "image/" + string(f)
+}
+
+// jpegQuality es la calidad de las versiones JPEG
+const jpegQuality = 85
+
+// Variant es una versión cuadrada ya codificada de una imagen
+type Variant struct {
+	Size   int
+	Format OutputFormat
+	Data   []byte
+}
+
+// ReadLimited lee r hasta limits.MaxBytes y devuelve ErrTooLarge si hay más
+func ReadLimited(r io.Reader, limits Limits) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// Sniff detecta el formato por los primeros bytes del contenido, sin fiarse de la extensión ni
+// del Content-Type que envía el cliente
+func Sniff(data []byte) (string, error) {
+	format, ok := contentTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", ErrUnsupportedFormat
+	}
+	return format, nil
+}
+
+// Decode comprueba el formato y las dimensiones declaradas en la cabecera de la imagen y solo
+// entonces la decodifica. La imagen resultante ya no lleva metadatos (EXIF, GPS, perfiles...)
+func Decode(data []byte, limits Limits) (image.Image, string, error) {
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, "", ErrTooLarge
+	}
+	format, err := Sniff(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	config, configFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || configFormat != format {
+		return nil, "", ErrCorrupt
+	}
+	if config.Width < limits.MinSide || config.Height < limits.MinSide ||
+		(limits.MaxSide > 0 && (config.Width > limits.MaxSide || config.Height > limits.MaxSide)) ||
+		(limits.MaxPixels > 0 && config.Width*config.Height > limits.MaxPixels) {
+		return nil, "", ErrDimensions
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrCorrupt
+	}
+	return img, format, nil
+}
+
+// CropSquare recorta el cuadrado central de la imagen
+func CropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	rect := image.Rect(x, y, x+side, y+side)
+
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// Resize escala la imagen a size x size píxeles. Se espera una imagen cuadrada (CropSquare)
+func Resize(img image.Image, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// Encode codifica la imagen en el formato indicado. JPEG no tiene transparencia, así que se
+// pone sobre fondo blanco; WebP se codifica sin pérdida
+func Encode(w io.Writer, img image.Image, format OutputFormat) error {
+	switch format {
+	case FormatJPEG:
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		return jpeg.Encode(w, flat, &jpeg.Options{Quality: jpegQuality})
+	case FormatWebP:
+		return nativewebp.Encode(w, img, nil)
+	}
+	return fmt.Errorf("formato de salida desconocido: %s", format)
+}
+
+// SquareVariants valida y decodifica la imagen y genera una versión cuadrada por cada tamaño y
+// formato, recortada al centro. Las imágenes más pequeñas que un tamaño se amplían
+func SquareVariants(data []byte, limits Limits, sizes []int, formats []OutputFormat) ([]Variant, error) {
+	img, format, err := Decode(data, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	// El recorte central y el escalado no cambian al girar o voltear, así que la orientación
+	// EXIF se aplica a las versiones pequeñas en lugar de a la imagen completa
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	square := CropSquare(img)
+	variants := make([]Variant, 0, len(sizes)*len(formats))
+	for _, size := range sizes {
+		resized := orient(Resize(square, size), orientation)
+		for _, output := range formats {
+			var buf bytes.Buffer
+			if err := Encode(&buf, resized, output); err != nil {
+				return nil, err
+			}
+			variants = append(variants, Variant{Size: size, Format: output, Data: buf.Bytes()})
+		}
+	}
+	return variants, nil
+}
@@ -0,0 +1,113 @@
+package jwtkeys
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FromEnv carga las claves de firma de JWT.
+//
+// Con JWT_KEYS_DIR se leen todos los ficheros .pem del directorio; el kid de cada clave es el
+// nombre del fichero sin extensión. Las claves privadas (PKCS#8 o PKCS#1, RSA o Ed25519) pueden
+// firmar y las públicas (PKIX) solo verificar, lo que permite retirar una clave sin invalidar los
+// tokens que firmó. JWT_ACTIVE_KID elige la clave con la que se firma; por defecto es la última
+// clave privada en orden alfabético, así que nombrar los ficheros por fecha basta para rotar.
+//
+// Sin JWT_KEYS_DIR se firma con HS256 usando JWT_SECRET, que debe ser distinto de SESSION_SECRET.
+// En ese modo el JWKS está vacío y otros servicios no pueden verificar los tokens
+func FromEnv() (*Manager, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, fmt.Errorf("es necesario definir JWT_KEYS_DIR o JWT_SECRET")
+		}
+		if secret == os.Getenv("SESSION_SECRET") {
+			return nil, fmt.Errorf("JWT_SECRET y SESSION_SECRET deben ser distintos")
+		}
+		log.Println("JWT_KEYS_DIR no está definido: los tokens se firman con HS256 y no se publican claves en el JWKS")
+		return NewManager(NewHMACKey("hs256", []byte(secret)))
+	}
+
+	return LoadDir(dir, os.Getenv("JWT_ACTIVE_KID"))
+}
+
+// LoadDir carga las claves .pem de un directorio y usa activeKID como clave de firma
+func LoadDir(dir, activeKID string) (*Manager, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var keys []*Key
+	var active *Key
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := loadPEM(id, path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+
+		if activeKID == "" && key.CanSign() {
+			active = key
+		} else if key.ID == activeKID {
+			active = key
+		}
+	}
+
+	if active == nil {
+		if activeKID != "" {
+			return nil, fmt.Errorf("no existe la clave activa %s en %s", activeKID, dir)
+		}
+		return nil, fmt.Errorf("no hay ninguna clave privada en %s", dir)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("la clave activa %s no tiene parte privada", active.ID)
+	}
+
+	return NewManager(active, keys...)
+}
+
+// loadPEM lee una clave privada o pública en formato PEM
+func loadPEM(id, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s no contiene ningún bloque PEM", path)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return newPrivateKey(id, private)
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return newPrivateKey(id, private)
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return newPublicKey(id, public)
+	default:
+		return nil, fmt.Errorf("%s: bloque PEM no soportado (%s)", path, block.Type)
+	}
+}
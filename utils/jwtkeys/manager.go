@@ -0,0 +1,144 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key es una clave de firma o de verificación de JWT identificada por su kid
+type Key struct {
+	ID        string
+	Algorithm string
+	// signer es la clave privada (o el secreto HMAC). Es nil en las claves solo de verificación
+	signer interface{}
+	// verifier es la clave pública (o el secreto HMAC)
+	verifier interface{}
+}
+
+// Method devuelve el método de firma de golang-jwt correspondiente al algoritmo de la clave
+func (k *Key) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// CanSign indica si la clave tiene parte privada
+func (k *Key) CanSign() bool {
+	return k.signer != nil
+}
+
+// Symmetric indica si la clave es un secreto HMAC (que nunca se publica)
+func (k *Key) Symmetric() bool {
+	_, ok := k.verifier.([]byte)
+	return ok
+}
+
+// newPrivateKey crea una Key a partir de una clave privada RSA o Ed25519
+func newPrivateKey(id string, private crypto.PrivateKey) (*Key, error) {
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("la clave RSA %s debe tener al menos 2048 bits", id)
+		}
+		return &Key{ID: id, Algorithm: "RS256", signer: key, verifier: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Algorithm: "EdDSA", signer: key, verifier: key.Public()}, nil
+	default:
+		return nil, fmt.Errorf("tipo de clave no soportado en %s: %T", id, private)
+	}
+}
+
+// newPublicKey crea una Key solo de verificación a partir de una clave pública RSA o Ed25519
+func newPublicKey(id string, public crypto.PublicKey) (*Key, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: id, Algorithm: "RS256", verifier: key}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Algorithm: "EdDSA", verifier: key}, nil
+	default:
+		return nil, fmt.Errorf("tipo de clave no soportado en %s: %T", id, public)
+	}
+}
+
+// NewHMACKey crea una clave simétrica HS256. Solo se usa cuando no hay claves asimétricas configuradas
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: "HS256", signer: secret, verifier: secret}
+}
+
+// Manager guarda la clave con la que se firman los tokens nuevos y todas las que se aceptan al
+// verificar. Para rotar se añade una clave nueva, se convierte en la activa y la anterior se
+// mantiene como clave de verificación hasta que caduquen los tokens que firmó
+type Manager struct {
+	active *Key
+	keys   map[string]*Key
+	// order conserva el orden de carga para publicar el JWKS de forma estable
+	order []string
+}
+
+// NewManager crea un gestor con la clave activa indicada y el resto de claves de verificación
+func NewManager(active *Key, others ...*Key) (*Manager, error) {
+	if active == nil || !active.CanSign() {
+		return nil, fmt.Errorf("la clave activa debe tener parte privada")
+	}
+
+	m := &Manager{active: active, keys: make(map[string]*Key)}
+	for _, key := range append([]*Key{active}, others...) {
+		if _, exists := m.keys[key.ID]; exists {
+			if key == active {
+				continue
+			}
+			return nil, fmt.Errorf("kid duplicado: %s", key.ID)
+		}
+		m.keys[key.ID] = key
+		m.order = append(m.order, key.ID)
+	}
+	return m, nil
+}
+
+// Sign firma los claims con la clave activa e incluye su kid en la cabecera
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.active.Method(), claims)
+	token.Header["kid"] = m.active.ID
+	return token.SignedString(m.active.signer)
+}
+
+// Keyfunc resuelve la clave de verificación de un token a partir de su kid. El algoritmo del
+// token debe coincidir con el de la clave, de modo que no se puede usar una clave pública como
+// secreto HMAC ni enviar tokens sin firmar
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key := m.active
+	if kid != "" {
+		var ok bool
+		if key, ok = m.keys[kid]; !ok {
+			return nil, fmt.Errorf("kid desconocido: %s", kid)
+		}
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("algoritmo inesperado: %s", token.Method.Alg())
+	}
+	return key.verifier, nil
+}
+
+// Algorithms devuelve los algoritmos de las claves de verificación, para jwt.WithValidMethods
+func (m *Manager) Algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, id := range m.order {
+		alg := m.keys[id].Algorithm
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// ActiveKeyID devuelve el kid de la clave con la que se firman los tokens nuevos
+func (m *Manager) ActiveKeyID() string {
+	return m.active.ID
+}
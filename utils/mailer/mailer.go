@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Message es un correo de texto plano
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// ErrHeaderInjection se devuelve si el destinatario o el asunto contienen saltos de línea, que
+// permitirían añadir cabeceras al correo
+var ErrHeaderInjection = errors.New("el destinatario o el asunto contienen saltos de línea")
+
+// validate rechaza los campos que acaban en las cabeceras si contienen CR o LF
+func (msg Message) validate() error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return ErrHeaderInjection
+	}
+	return nil
+}
+
+// Mailer envía correos. Hay una implementación SMTP para producción y un buzón en
+// disco (outbox) para desarrollo local y pruebas
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// FromEnv construye el Mailer configurado en MAILER_DRIVER ("smtp" u "outbox", por defecto "outbox")
+func FromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "NovelUzu <no-reply@noveluzu.local>"
+	}
+
+	switch strings.ToLower(os.Getenv("MAILER_DRIVER")) {
+	case "smtp":
+		m := &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+		if m.Host == "" || m.Port == "" {
+			return nil, fmt.Errorf("SMTP_HOST y SMTP_PORT son obligatorios con MAILER_DRIVER=smtp")
+		}
+		return m, nil
+	case "", "outbox":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		return &OutboxMailer{Dir: dir, From: from}, nil
+	default:
+		return nil, fmt.Errorf("MAILER_DRIVER desconocido: %s", os.Getenv("MAILER_DRIVER"))
+	}
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OutboxMailer guarda cada correo como un fichero .eml en Dir en lugar de enviarlo.
+// Pensado para desarrollo local y pruebas
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+// Send implementa Mailer
+func (m *OutboxMailer) Send(msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("error al crear el directorio outbox: %v", err)
+	}
+
+	// El destinatario se incluye en el nombre para localizar los correos fácilmente
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	filename := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+
+	if err := os.WriteFile(filepath.Join(m.Dir, filename), buildMessage(m.From, msg), 0o644); err != nil {
+		return fmt.Errorf("error al escribir el correo en outbox: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"NovelUzu/utils"
+)
+
+// NewPKCE genera un code_verifier y su code_challenge S256 (RFC 7636)
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
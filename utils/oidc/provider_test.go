@@ -0,0 +1,223 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP es un proveedor OpenID Connect en memoria: sirve el documento de descubrimiento, el
+// JWKS y un endpoint de token que canjea un único código por un ID token firmado
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	code         string
+	codeVerifier string
+	nonce        string
+	// claims sobrescribe los claims del ID token emitido
+	claims func(jwt.MapClaims)
+	// method sobrescribe el algoritmo de firma del ID token
+	method jwt.SigningMethod
+	// headerKid sobrescribe el kid de la cabecera del ID token
+	headerKid string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{t: t, key: key, kid: "clave-1", code: "codigo-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != "noveluzu" || secret != "secreto" {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("grant_type") != "authorization_code" || r.FormValue("code") != idp.code ||
+		r.FormValue("code_verifier") != idp.codeVerifier || r.FormValue("redirect_uri") != "https://api.example/callback" {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "acceso",
+		"token_type":   "Bearer",
+		"id_token":     idp.idToken(),
+		"expires_in":   3600,
+	})
+}
+
+func (idp *mockIdP) idToken() string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "usuario-123",
+		"aud":            "noveluzu",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          idp.nonce,
+		"email":          " Ana@Example.com ",
+		"email_verified": "true",
+		"name":           "Ana",
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+	method := idp.method
+	if method == nil {
+		method = jwt.SigningMethodRS256
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = idp.kid
+	if idp.headerKid != "" {
+		token.Header["kid"] = idp.headerKid
+	}
+
+	var key any = idp.key
+	if method == jwt.SigningMethodHS256 {
+		key = []byte("secreto")
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return raw
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "mock",
+		Issuer:       idp.server.URL,
+		ClientID:     "noveluzu",
+		ClientSecret: "secreto",
+		RedirectURL:  "https://api.example/callback",
+	}, idp.server.Client())
+}
+
+// login recorre el flujo completo: URL de autorización, canje del código y verificación del ID token
+func (idp *mockIdP) login(provider *Provider) (*Identity, error) {
+	ctx := context.Background()
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	idp.codeVerifier = verifier
+	idp.nonce = "nonce-1"
+
+	authURL, err := provider.AuthCodeURL(ctx, "estado-1", idp.nonce, challenge)
+	if err != nil {
+		return nil, err
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if parsed.Path != "/authorize" || query.Get("state") != "estado-1" || query.Get("nonce") != idp.nonce ||
+		query.Get("code_challenge") != challenge || query.Get("code_challenge_method") != "S256" {
+		idp.t.Fatalf("URL de autorización inesperada: %s", authURL)
+	}
+
+	tokens, err := provider.Exchange(ctx, idp.code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return provider.VerifyIDToken(ctx, tokens.IDToken, idp.nonce)
+}
+
+func TestLoginAgainstMockIdP(t *testing.T) {
+	idp := newMockIdP(t)
+
+	identity, err := idp.login(idp.provider())
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if identity.Subject != "usuario-123" || identity.Email != "ana@example.com" || !identity.EmailVerified || identity.Name != "Ana" {
+		t.Errorf("identidad inesperada: %+v", identity)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.codeVerifier = "otro"
+
+	if _, err := idp.provider().Exchange(context.Background(), idp.code, "verificador-robado"); err == nil {
+		t.Fatal("Exchange con un code_verifier incorrecto debería fallar")
+	}
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	cases := map[string]func(idp *mockIdP){
+		"nonce distinto": func(idp *mockIdP) { idp.claims = func(c jwt.MapClaims) { c["nonce"] = "otro" } },
+		"otra audiencia": func(idp *mockIdP) { idp.claims = func(c jwt.MapClaims) { c["aud"] = "otra-app" } },
+		"otro emisor":    func(idp *mockIdP) { idp.claims = func(c jwt.MapClaims) { c["iss"] = "https://falso.example" } },
+		"caducado": func(idp *mockIdP) {
+			idp.claims = func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }
+		},
+		"sin sub": func(idp *mockIdP) { idp.claims = func(c jwt.MapClaims) { delete(c, "sub") } },
+		"azp de otro": func(idp *mockIdP) {
+			idp.claims = func(c jwt.MapClaims) { c["aud"] = []string{"noveluzu", "otra-app"}; c["azp"] = "otra-app" }
+		},
+		"firmado con HMAC": func(idp *mockIdP) { idp.method = jwt.SigningMethodHS256 },
+		"kid desconocido":  func(idp *mockIdP) { idp.headerKid = "clave-2" },
+	}
+	for name, setup := range cases {
+		t.Run(name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			provider := idp.provider()
+			setup(idp)
+			if identity, err := idp.login(provider); err == nil {
+				t.Fatalf("se aceptó un ID token inválido: %+v", identity)
+			}
+		})
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	provider.Issuer = strings.Replace(idp.server.URL, "127.0.0.1", "localhost", 1)
+
+	if _, err := provider.AuthCodeURL(context.Background(), "estado", "nonce", "reto"); err == nil {
+		t.Fatal("se aceptó un documento de descubrimiento de otro emisor")
+	}
+}
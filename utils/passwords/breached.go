@@ -0,0 +1,115 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// BreachedList comprueba si una contraseña aparece en filtraciones conocidas sin consultar
+// ningún servicio externo
+type BreachedList interface {
+	Contains(password string) (bool, error)
+}
+
+// sha1Hex devuelve el SHA-1 de la contraseña en hexadecimal en mayúsculas, como en Have I Been Pwned
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// memoryList guarda en memoria los SHA-1 de un fichero con una línea "HASH" o "HASH:COUNT" por contraseña
+type memoryList struct {
+	hashes map[string]struct{}
+}
+
+func (l *memoryList) Contains(password string) (bool, error) {
+	_, found := l.hashes[sha1Hex(password)]
+	return found, nil
+}
+
+// rangeList lee bajo demanda un directorio con un fichero por prefijo de 5 caracteres del SHA-1
+// (p. ej. "21BD1" o "21BD1.txt") con líneas "SUFIJO:COUNT", el formato de la API de rangos de
+// Have I Been Pwned. Permite usar la lista completa sin cargarla en memoria
+type rangeList struct {
+	dir string
+}
+
+func (l *rangeList) Contains(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(l.dir, prefix))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(l.dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// LoadBreachedList abre la lista de contraseñas filtradas: un directorio de rangos o un fichero de hashes
+func LoadBreachedList(path string) (BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &rangeList{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &memoryList{hashes: make(map[string]struct{})}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+		list.hashes[strings.ToUpper(hash)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %v", path, err)
+	}
+	return list, nil
+}
+
+var breached struct {
+	once sync.Once
+	list BreachedList
+	err  error
+}
+
+// BreachedFromEnv carga (una sola vez) la lista indicada en BREACHED_PASSWORDS_PATH.
+// Devuelve nil si la variable no está definida
+func BreachedFromEnv() (BreachedList, error) {
+	breached.once.Do(func() {
+		if path := os.Getenv("BREACHED_PASSWORDS_PATH"); path != "" {
+			breached.list, breached.err = LoadBreachedList(path)
+		}
+	})
+	return breached.list, breached.err
+}
@@ -0,0 +1,175 @@
+// Package passwords genera y verifica los hashes de contraseña que se guardan en users.password_hash.
+//
+// Los hashes nuevos usan Argon2id en formato PHC, que incluye el algoritmo y sus parámetros:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<sal>$<hash>
+//
+// Así se pueden endurecer los parámetros (ARGON2_MEMORY, ARGON2_ITERATIONS, ARGON2_PARALLELISM)
+// sin invalidar los hashes existentes. Los hashes bcrypt heredados se siguen aceptando y Verify
+// indica que conviene regenerarlos cuando el usuario vuelve a introducir la contraseña
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Params son los parámetros de coste de Argon2id
+type Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams sigue las recomendaciones de OWASP con margen (64 MiB, 3 pasadas)
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// ErrInvalidHash se devuelve si el hash guardado no tiene un formato reconocido
+var ErrInvalidHash = errors.New("formato de hash de contraseña no reconocido")
+
+// ParamsFromEnv devuelve DefaultParams con los valores de ARGON2_MEMORY (KiB), ARGON2_ITERATIONS
+// y ARGON2_PARALLELISM si están definidos
+func ParamsFromEnv() Params {
+	params := DefaultParams
+	if value, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY"), 10, 32); err == nil && value >= 8*1024 {
+		params.Memory = uint32(value)
+	}
+	if value, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 10, 32); err == nil && value >= 1 {
+		params.Iterations = uint32(value)
+	}
+	if value, err := strconv.ParseUint(os.Getenv("ARGON2_PARALLELISM"), 10, 8); err == nil && value >= 1 {
+		params.Parallelism = uint8(value)
+	}
+	return params
+}
+
+// Hash genera el hash Argon2id de la contraseña con los parámetros configurados
+func Hash(password string) (string, error) {
+	return HashWithParams(password, ParamsFromEnv())
+}
+
+// HashWithParams genera el hash Argon2id de la contraseña con los parámetros indicados
+func HashWithParams(password string, params Params) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify comprueba la contraseña contra el hash guardado. needsRehash es true si la contraseña es
+// correcta pero el hash usa un algoritmo antiguo o parámetros distintos de los actuales.
+// Un hash vacío (cuentas sin contraseña) nunca coincide
+func Verify(password, encoded string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case encoded == "":
+		return false, false, nil
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false, nil
+		}
+		current := ParamsFromEnv()
+		needsRehash = params.Memory != current.Memory || params.Iterations != current.Iterations ||
+			params.Parallelism != current.Parallelism || uint32(len(key)) != current.KeyLength
+		return true, needsRehash, nil
+	case strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	default:
+		return false, false, ErrInvalidHash
+	}
+}
+
+// dummyHash es un hash Argon2id con los parámetros actuales de una contraseña aleatoria que nadie conoce
+var dummyHash = sync.OnceValue(func() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	hash, err := Hash(base64.RawStdEncoding.EncodeToString(secret))
+	if err != nil {
+		return ""
+	}
+	return hash
+})
+
+// VerifyDummy hace el mismo trabajo que Verify con un hash Argon2id real y descarta el resultado.
+// Se llama cuando no hay hash con el que comparar (correo inexistente, cuenta sin contraseña) para
+// que el tiempo de respuesta no revele qué cuentas existen
+func VerifyDummy(password string) {
+	Verify(password, dummyHash())
+}
+
+// Matches es un atajo de Verify para cuando no interesa regenerar el hash
+func Matches(password, encoded string) bool {
+	ok, _, err := Verify(password, encoded)
+	return err == nil && ok
+}
+
+// decodeArgon2id separa un hash PHC de Argon2id en sus parámetros, la sal y la clave
+func decodeArgon2id(encoded string) (Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", sal, clave
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("versión de Argon2 no soportada: %d", version)
+	}
+
+	var params Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,114 @@
+package passwords
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams son parámetros baratos para que los tests no tarden
+var testParams = Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// useParams hace que ParamsFromEnv devuelva params durante el test
+func useParams(t *testing.T, params Params) {
+	t.Setenv("ARGON2_MEMORY", strconv.FormatUint(uint64(params.Memory), 10))
+	t.Setenv("ARGON2_ITERATIONS", strconv.FormatUint(uint64(params.Iterations), 10))
+	t.Setenv("ARGON2_PARALLELISM", strconv.FormatUint(uint64(params.Parallelism), 10))
+}
+
+func TestHashRoundTrip(t *testing.T) {
+	useParams(t, testParams)
+
+	hash, err := HashWithParams("correct horse battery staple", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$") {
+		t.Errorf("formato inesperado: %s", hash)
+	}
+
+	ok, needsRehash, err := Verify("correct horse battery staple", hash)
+	if err != nil || !ok || needsRehash {
+		t.Errorf("Verify con la contraseña correcta = %v, %v, %v", ok, needsRehash, err)
+	}
+	if ok, _, err := Verify("Correct horse battery staple", hash); err != nil || ok {
+		t.Errorf("Verify con otra contraseña = %v, %v", ok, err)
+	}
+
+	other, _ := HashWithParams("correct horse battery staple", testParams)
+	if other == hash {
+		t.Error("dos hashes de la misma contraseña comparten sal")
+	}
+}
+
+func TestVerifyNeedsRehashWhenParamsChange(t *testing.T) {
+	hash, err := HashWithParams("contraseña", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := testParams
+	stronger.Iterations = 2
+	useParams(t, stronger)
+
+	ok, needsRehash, err := Verify("contraseña", hash)
+	if err != nil || !ok || !needsRehash {
+		t.Errorf("Verify = %v, %v, %v; se esperaba que pidiera regenerar el hash", ok, needsRehash, err)
+	}
+	if ok, needsRehash, _ := Verify("otra", hash); ok || needsRehash {
+		t.Error("una contraseña incorrecta no debe pedir regenerar el hash")
+	}
+}
+
+func TestVerifyAcceptsLegacyBcrypt(t *testing.T) {
+	useParams(t, testParams)
+	legacy, err := bcrypt.GenerateFromPassword([]byte("contraseña"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, needsRehash, err := Verify("contraseña", string(legacy))
+	if err != nil || !ok || !needsRehash {
+		t.Errorf("Verify = %v, %v, %v; se esperaba aceptarlo y pedir regenerarlo", ok, needsRehash, err)
+	}
+	if ok, _, err := Verify("otra", string(legacy)); err != nil || ok {
+		t.Errorf("Verify con otra contraseña = %v, %v", ok, err)
+	}
+}
+
+func TestVerifyEmptyHashNeverMatches(t *testing.T) {
+	for _, password := range []string{"", "contraseña"} {
+		if ok, needsRehash, err := Verify(password, ""); ok || needsRehash || err != nil {
+			t.Errorf("Verify(%q, \"\") = %v, %v, %v", password, ok, needsRehash, err)
+		}
+	}
+}
+
+func TestVerifyRejectsGarbage(t *testing.T) {
+	for _, encoded := range []string{
+		"contraseña-en-claro",
+		"$argon2id$",
+		"$argon2id$v=19$m=8192,t=1,p=1$sal",
+		"$argon2id$v=x$m=8192,t=1,p=1$c2Fs$Y2xhdmU",
+		"$argon2id$v=19$m=a,t=1,p=1$c2Fs$Y2xhdmU",
+		"$argon2id$v=19$m=8192,t=1,p=1$!!!$Y2xhdmU",
+		"$argon2id$v=19$m=8192,t=1,p=1$c2Fs$",
+		"$1$md5$antiguo",
+	} {
+		ok, _, err := Verify("contraseña", encoded)
+		if ok || !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Verify(%q) = %v, %v; se esperaba ErrInvalidHash", encoded, ok, err)
+		}
+	}
+}
+
+func TestVerifyDummyDoesNotPanic(t *testing.T) {
+	useParams(t, testParams)
+	VerifyDummy("contraseña")
+	if !strings.HasPrefix(dummyHash(), "$argon2id$") {
+		t.Errorf("el hash ficticio no es Argon2id: %q", dummyHash())
+	}
+}
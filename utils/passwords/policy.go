@@ -0,0 +1,178 @@
+package passwords
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Códigos de los incumplimientos de la política, pensados para que el frontend los traduzca
+const (
+	ViolationTooShort     = "too_short"
+	ViolationTooLong      = "too_long"
+	ViolationNoLowercase  = "missing_lowercase"
+	ViolationNoUppercase  = "missing_uppercase"
+	ViolationNoDigit      = "missing_digit"
+	ViolationNoSymbol     = "missing_symbol"
+	ViolationPersonalInfo = "contains_personal_info"
+	ViolationTooWeak      = "too_weak"
+	ViolationBreached     = "breached"
+)
+
+// Policy son los requisitos que debe cumplir una contraseña nueva
+type Policy struct {
+	MinLength     int  `json:"min_length"`
+	MaxLength     int  `json:"max_length"`
+	RequireLower  bool `json:"require_lowercase"`
+	RequireUpper  bool `json:"require_uppercase"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+	// MinScore es la puntuación mínima de Strength (0-4)
+	MinScore      int  `json:"min_score"`
+	CheckBreached bool `json:"check_breached"`
+}
+
+// Violation es un requisito incumplido
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Result es el resultado de comprobar una contraseña contra la política
+type Result struct {
+	Score      int         `json:"score"`
+	MinScore   int         `json:"min_score"`
+	Violations []Violation `json:"violations"`
+}
+
+// Valid indica si la contraseña cumple todos los requisitos
+func (r Result) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+// PolicyFromEnv construye la política a partir de PASSWORD_MIN_LENGTH (8 por defecto),
+// PASSWORD_MAX_LENGTH (128), PASSWORD_REQUIRE (lista de lower, upper, digit y symbol),
+// PASSWORD_MIN_SCORE (2) y BREACHED_PASSWORDS_PATH
+func PolicyFromEnv() Policy {
+	policy := Policy{MinLength: 8, MaxLength: 128, MinScore: 2}
+
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && value > 0 {
+		policy.MinLength = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH")); err == nil && value >= policy.MinLength {
+		policy.MaxLength = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_SCORE")); err == nil && value >= 0 && value <= 4 {
+		policy.MinScore = value
+	}
+	for _, class := range strings.Split(os.Getenv("PASSWORD_REQUIRE"), ",") {
+		switch strings.TrimSpace(strings.ToLower(class)) {
+		case "lower":
+			policy.RequireLower = true
+		case "upper":
+			policy.RequireUpper = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		}
+	}
+	policy.CheckBreached = os.Getenv("BREACHED_PASSWORDS_PATH") != ""
+
+	return policy
+}
+
+// personalInputs extrae del nombre de usuario y el correo los fragmentos que no deben aparecer en la contraseña
+func personalInputs(inputs []string) []string {
+	var result []string
+	for _, input := range inputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if local, _, found := strings.Cut(input, "@"); found {
+			input = local
+		}
+		if utf8.RuneCountInString(input) >= 3 {
+			result = append(result, input)
+		}
+	}
+	return result
+}
+
+// Check comprueba la contraseña. userInputs son el nombre de usuario, el correo y cualquier otro
+// dato personal que no debe formar parte de ella
+func (p Policy) Check(password string, userInputs ...string) (Result, error) {
+	result := Result{MinScore: p.MinScore, Violations: []Violation{}}
+	add := func(code, message string) {
+		result.Violations = append(result.Violations, Violation{Code: code, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add(ViolationTooShort, fmt.Sprintf("Debe tener al menos %d caracteres", p.MinLength))
+	}
+	if length > p.MaxLength {
+		add(ViolationTooLong, fmt.Sprintf("No puede tener más de %d caracteres", p.MaxLength))
+		// No se sigue analizando una entrada desproporcionada
+		return result, nil
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.RequireLower && !hasLower {
+		add(ViolationNoLowercase, "Debe contener al menos una letra minúscula")
+	}
+	if p.RequireUpper && !hasUpper {
+		add(ViolationNoUppercase, "Debe contener al menos una letra mayúscula")
+	}
+	if p.RequireDigit && !hasDigit {
+		add(ViolationNoDigit, "Debe contener al menos un número")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add(ViolationNoSymbol, "Debe contener al menos un símbolo")
+	}
+
+	personal := personalInputs(userInputs)
+	lower := strings.ToLower(password)
+	for _, input := range personal {
+		if strings.Contains(lower, input) {
+			add(ViolationPersonalInfo, "No puede contener tu nombre de usuario ni tu correo electrónico")
+			break
+		}
+	}
+
+	result.Score = Strength(password, personal...)
+	if result.Score < p.MinScore {
+		add(ViolationTooWeak, "Es demasiado fácil de adivinar. Usa una frase más larga o combina palabras poco relacionadas")
+	}
+
+	if p.CheckBreached {
+		list, err := BreachedFromEnv()
+		if err != nil {
+			return result, err
+		}
+		if list != nil {
+			found, err := list.Contains(password)
+			if err != nil {
+				return result, err
+			}
+			if found {
+				add(ViolationBreached, "Aparece en filtraciones de datos conocidas. Elige otra")
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,214 @@
+package passwords
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords son contraseñas y palabras muy habituales. No pretende ser exhaustiva: las
+// filtradas de verdad se comprueban con la lista de BREACHED_PASSWORDS_PATH
+var commonPasswords = []string{
+	"password", "contraseña", "contrasena", "qwerty", "123456", "12345678", "123456789", "111111",
+	"abc123", "iloveyou", "admin", "welcome", "monkey", "dragon", "football", "futbol", "baseball",
+	"letmein", "master", "sunshine", "princess", "princesa", "shadow", "superman", "batman",
+	"trustno1", "hello", "hola", "secret", "secreto", "login", "passw0rd", "starwars", "pokemon",
+	"naruto", "anime", "manga", "novela", "novel", "noveluzu", "usuario", "user", "test", "prueba",
+	"amor", "teamo", "barcelona", "madrid", "realmadrid", "america", "mexico", "argentina",
+	"espana", "colombia", "chile", "peru", "qwertyuiop", "asdfgh", "zxcvbn", "access", "freedom",
+	"whatever", "charlie", "michael", "jordan", "mustang", "computer", "internet", "samsung",
+	"google", "minecraft", "fortnite", "summer", "winter", "spring", "autumn", "flower", "lovely",
+}
+
+// keyboardRows se usan para detectar secuencias como "qwerty" o "asdf"
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// leetReplacer deshace las sustituciones típicas (p@ssw0rd -> password) antes de buscar palabras
+var leetReplacer = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t")
+
+// Strength estima, al estilo de zxcvbn, lo fácil que es adivinar la contraseña. Devuelve una
+// puntuación de 0 (trivial) a 4 (muy fuerte). userInputs son datos del usuario (nombre, email...)
+// que un atacante probaría primero
+func Strength(password string, userInputs ...string) int {
+	log10Guesses := estimateGuesses(password, userInputs)
+	switch {
+	case log10Guesses < 3:
+		return 0
+	case log10Guesses < 6:
+		return 1
+	case log10Guesses < 8:
+		return 2
+	case log10Guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// estimateGuesses recorre la contraseña de izquierda a derecha buscando en cada posición el patrón
+// más largo (palabra conocida, repetición, secuencia o año). Lo que no encaja en ningún patrón se
+// cuenta como fuerza bruta sobre el alfabeto de la contraseña. Devuelve log10 del número de intentos
+func estimateGuesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	lower := []rune(strings.ToLower(password))
+	unleet := []rune(leetReplacer.Replace(strings.ToLower(password)))
+	if len(unleet) != len(lower) {
+		// Las sustituciones son de un carácter por otro, pero por si acaso se usa la versión sin normalizar
+		unleet = lower
+	}
+
+	dictionary := make([]string, 0, len(commonPasswords)+len(userInputs))
+	dictionary = append(dictionary, commonPasswords...)
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if len([]rune(input)) >= 3 {
+			dictionary = append(dictionary, input)
+		}
+	}
+	log10Dictionary := math.Log10(float64(len(dictionary)))
+	log10Charset := math.Log10(float64(charsetSize(runes)))
+
+	total := 0.0
+	for i := 0; i < len(runes); {
+		best, cost := 1, log10Charset
+
+		// Palabras conocidas, incluidas las escritas con l33t o mayúsculas
+		for _, word := range dictionary {
+			wordRunes := []rune(word)
+			n := len(wordRunes)
+			if n <= best || i+n > len(runes) {
+				continue
+			}
+			if string(lower[i:i+n]) == word || string(unleet[i:i+n]) == word {
+				c := log10Dictionary
+				if string(runes[i:i+n]) != string(lower[i:i+n]) {
+					c++ // variación de mayúsculas
+				}
+				if string(lower[i:i+n]) != word {
+					c++ // sustituciones l33t
+				}
+				best, cost = n, c
+			}
+		}
+
+		// Mismo carácter repetido (aaaa, 1111)
+		if n := repeatLength(lower, i); n >= 3 && n > best {
+			best, cost = n, math.Log10(float64(charsetSize(runes[i:i+1])*n))
+		}
+
+		// Secuencias del alfabeto, de dígitos o del teclado (abcd, 4321, qwer)
+		if n := sequenceLength(lower, i); n >= 3 && n > best {
+			best, cost = n, math.Log10(float64(20*n))
+		}
+
+		// Años recientes
+		if i+4 <= len(runes) && best < 4 {
+			if year := string(runes[i : i+4]); (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && isDigits(year) {
+				best, cost = 4, math.Log10(150)
+			}
+		}
+
+		total += cost
+		i += best
+	}
+	return total
+}
+
+// charsetSize devuelve el tamaño del alfabeto que usaría un ataque de fuerza bruta
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	if size == 0 {
+		size = 10
+	}
+	return size
+}
+
+// repeatLength devuelve cuántas veces se repite seguido el carácter de la posición i
+func repeatLength(runes []rune, i int) int {
+	n := 1
+	for i+n < len(runes) && runes[i+n] == runes[i] {
+		n++
+	}
+	return n
+}
+
+// sequenceLength devuelve la longitud de la secuencia ascendente o descendente que empieza en i
+func sequenceLength(runes []rune, i int) int {
+	best := 1
+
+	// Secuencias por código (abc, 123, cba)
+	for _, step := range []rune{1, -1} {
+		n := 1
+		for i+n < len(runes) && runes[i+n]-runes[i+n-1] == step && (unicode.IsLetter(runes[i+n]) || unicode.IsDigit(runes[i+n])) {
+			n++
+		}
+		if n > best {
+			best = n
+		}
+	}
+
+	// Secuencias del teclado (qwerty, asdf, poiu)
+	for _, row := range keyboardRows {
+		for _, line := range []string{row, reverse(row)} {
+			n := 0
+			for i+n < len(runes) {
+				if !strings.Contains(line, string(runes[i:i+n+1])) {
+					break
+				}
+				n++
+			}
+			if n > best {
+				best = n
+			}
+		}
+	}
+	return best
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
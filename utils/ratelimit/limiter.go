@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate es un número máximo de peticiones por ventana de tiempo
+type Rate struct {
+	Limit  int64
+	Window time.Duration
+}
+
+// ParseRate interpreta cadenas con el formato "<peticiones>/<duración>", p. ej. "10/1m"
+func ParseRate(value string) (Rate, error) {
+	limitPart, windowPart, found := strings.Cut(value, "/")
+	if !found {
+		return Rate{}, fmt.Errorf("formato de límite inválido %q, se esperaba <peticiones>/<duración>", value)
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(limitPart), 10, 64)
+	if err != nil || limit <= 0 {
+		return Rate{}, fmt.Errorf("número de peticiones inválido en %q", value)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowPart))
+	if err != nil || window <= 0 {
+		return Rate{}, fmt.Errorf("duración inválida en %q", value)
+	}
+	return Rate{Limit: limit, Window: window}, nil
+}
+
+// RateFromEnv lee un Rate de una variable de entorno, usando fallback si no está definida o es inválida
+func RateFromEnv(key string, fallback Rate) Rate {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	rate, err := ParseRate(value)
+	if err != nil {
+		return fallback
+	}
+	return rate
+}
+
+// Result es el resultado de comprobar un límite
+type Result struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	RetryAfter time.Duration
+}
+
+// Limiter aplica un límite de ventana fija sobre un Store
+type Limiter struct {
+	store Store
+	name  string
+	rate  Rate
+}
+
+// NewLimiter crea un Limiter. name separa los contadores de distintos limitadores en el mismo Store
+func NewLimiter(store Store, name string, rate Rate) *Limiter {
+	return &Limiter{store: store, name: name, rate: rate}
+}
+
+// Allow cuenta una petición para key e indica si se permite
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	count, ttl, err := l.store.Increment(ctx, "limit:"+l.name+":"+key, l.rate.Window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:   count <= l.rate.Limit,
+		Limit:     l.rate.Limit,
+		Remaining: max(l.rate.Limit-count, 0),
+	}
+	if !result.Allowed {
+		result.RetryAfter = ttl
+	}
+	return result, nil
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Lockout bloquea una clave (una cuenta, una IP...) tras varios fallos seguidos. Cada fallo
+// por encima del umbral duplica la duración del bloqueo, hasta MaxDelay
+type Lockout struct {
+	store Store
+	name  string
+
+	// Threshold es el número de fallos tolerados antes del primer bloqueo
+	Threshold int64
+	// BaseDelay es la duración del primer bloqueo
+	BaseDelay time.Duration
+	// MaxDelay limita el crecimiento exponencial
+	MaxDelay time.Duration
+	// FailureWindow es el tiempo tras el último fallo al cabo del cual se olvidan los fallos
+	FailureWindow time.Duration
+}
+
+// NewLockout crea un Lockout con los parámetros por defecto (5 fallos, 30s, 1h, 24h)
+func NewLockout(store Store, name string) *Lockout {
+	return &Lockout{
+		store:         store,
+		name:          name,
+		Threshold:     5,
+		BaseDelay:     30 * time.Second,
+		MaxDelay:      time.Hour,
+		FailureWindow: 24 * time.Hour,
+	}
+}
+
+func (l *Lockout) failuresKey(key string) string { return "lockout:" + l.name + ":failures:" + key }
+func (l *Lockout) lockKey(key string) string     { return "lockout:" + l.name + ":lock:" + key }
+
+// Check devuelve cuánto falta para que key deje de estar bloqueada (0 si no lo está)
+func (l *Lockout) Check(ctx context.Context, key string) (time.Duration, error) {
+	return l.store.TTL(ctx, l.lockKey(key))
+}
+
+// Fail registra un fallo para key y devuelve la duración del bloqueo resultante (0 si aún no se bloquea)
+func (l *Lockout) Fail(ctx context.Context, key string) (time.Duration, error) {
+	failures, _, err := l.store.Increment(ctx, l.failuresKey(key), l.FailureWindow)
+	if err != nil {
+		return 0, err
+	}
+	if failures < l.Threshold {
+		return 0, nil
+	}
+
+	delay := l.BaseDelay
+	for i := l.Threshold; i < failures && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, l.MaxDelay)
+
+	if err := l.store.Set(ctx, l.lockKey(key), delay); err != nil {
+		return 0, err
+	}
+	return delay, nil
+}
+
+// Reset olvida los fallos y el bloqueo de key (p. ej. tras un inicio de sesión correcto)
+func (l *Lockout) Reset(ctx context.Context, key string) error {
+	return l.store.Delete(ctx, l.failuresKey(key), l.lockKey(key))
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// LoginGuard protege frente a fuerza bruta combinando un bloqueo por cuenta y otro por IP
+type LoginGuard struct {
+	Account *Lockout
+	IP      *Lockout
+}
+
+// NewLoginGuard crea un LoginGuard. Por IP se toleran más fallos, ya que varias personas pueden compartir IP
+func NewLoginGuard(store Store) *LoginGuard {
+	ip := NewLockout(store, "login_ip")
+	ip.Threshold = 20
+	return &LoginGuard{
+		Account: NewLockout(store, "login_account"),
+		IP:      ip,
+	}
+}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Check devuelve cuánto falta para poder volver a intentarlo (0 si no hay bloqueo)
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	accountWait, err := g.Account.Check(ctx, accountKey(email))
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := g.IP.Check(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+	return max(accountWait, ipWait), nil
+}
+
+// Fail registra un intento fallido para la cuenta y la IP. Devuelve el bloqueo resultante
+func (g *LoginGuard) Fail(ctx context.Context, email, ip string) (time.Duration, error) {
+	accountWait, err := g.Account.Fail(ctx, accountKey(email))
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := g.IP.Fail(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+	return max(accountWait, ipWait), nil
+}
+
+// Succeed olvida los fallos de la cuenta. Los de la IP se mantienen para que un atacante
+// no pueda limpiarlos iniciando sesión con su propia cuenta
+func (g *LoginGuard) Succeed(ctx context.Context, email string) error {
+	return g.Account.Reset(ctx, accountKey(email))
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryStore implementa Store en memoria. Solo sirve si hay una única instancia del backend
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+// NewMemoryStore crea un MemoryStore y arranca la limpieza periódica de claves caducadas
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{entries: make(map[string]*memoryEntry)}
+	go s.cleanup(time.Minute)
+	return s
+}
+
+func (s *MemoryStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		s.mu.Lock()
+		for key, entry := range s.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// get devuelve la entrada de key si no ha caducado. Se llama con el lock tomado
+func (s *MemoryStore) get(key string, now time.Time) *memoryEntry {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// Increment implementa Store
+func (s *MemoryStore) Increment(_ context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.get(key, now)
+	if entry == nil {
+		entry = &memoryEntry{expiresAt: now.Add(window)}
+		s.entries[key] = entry
+	}
+	entry.count++
+	return entry.count, entry.expiresAt.Sub(now), nil
+}
+
+// Set implementa Store
+func (s *MemoryStore) Set(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	s.entries[key] = &memoryEntry{count: 1, expiresAt: time.Now().Add(ttl)}
+	s.mu.Unlock()
+	return nil
+}
+
+// TTL implementa Store
+func (s *MemoryStore) TTL(_ context.Context, key string) (time.Duration, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.get(key, now)
+	if entry == nil {
+		return 0, nil
+	}
+	return entry.expiresAt.Sub(now), nil
+}
+
+// Delete implementa Store
+func (s *MemoryStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	redisconfig "NovelUzu/config/redis"
+)
+
+// Store guarda contadores con caducidad. Hay un backend en memoria (una sola instancia)
+// y otro en Redis (compartido entre instancias)
+type Store interface {
+	// Increment suma uno al contador key. Si el contador no existía caduca tras window.
+	// Devuelve el nuevo valor y el tiempo que le queda
+	Increment(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+	// Set crea (o sobrescribe) key con caducidad ttl
+	Set(ctx context.Context, key string, ttl time.Duration) error
+	// TTL devuelve el tiempo que le queda a key, o 0 si no existe
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Delete elimina las claves indicadas
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// NewStoreFromEnv construye el Store indicado en RATE_LIMIT_STORE ("memory" por defecto, o "redis" usando REDIS_URL)
+func NewStoreFromEnv() (Store, error) {
+	switch strings.ToLower(os.Getenv("RATE_LIMIT_STORE")) {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "redis":
+		client, err := redisconfig.ConnectRedis()
+		if err != nil {
+			return nil, err
+		}
+		return NewRedisStore(client, "ratelimit:"), nil
+	default:
+		return nil, fmt.Errorf("RATE_LIMIT_STORE desconocido: %s", os.Getenv("RATE_LIMIT_STORE"))
+	}
+}
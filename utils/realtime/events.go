@@ -0,0 +1,30 @@
+package realtime
+
+// Eventos que el servidor envía a los clientes
+const (
+	EventNotification = "notification"
+	EventChapterNew   = "chapter:new"
+	EventCommentReply = "comment:reply"
+)
+
+// Eventos que los clientes envían al servidor
+const (
+	EventNovelSubscribe   = "novel:subscribe"
+	EventNovelUnsubscribe = "novel:unsubscribe"
+)
+
+// NotifyUser envía una notificación a todas las conexiones abiertas del usuario
+func (h *Hub) NotifyUser(email string, notification any) int {
+	return h.Emit(UserRoom(email), EventNotification, notification)
+}
+
+// PublishChapter avisa a los lectores suscritos a la novela de que hay un capítulo nuevo
+func (h *Hub) PublishChapter(novelID uint, chapter any) int {
+	return h.Emit(NovelRoom(novelID), EventChapterNew, chapter)
+}
+
+// PublishCommentReply avisa al autor de un comentario de que le han respondido. No comprueba
+// bloqueos ni silencios: los handlers deben usar controllers.PublishCommentReply
+func (h *Hub) PublishCommentReply(email string, reply any) int {
+	return h.Emit(UserRoom(email), EventCommentReply, reply)
+}
@@ -0,0 +1,134 @@
+package realtime
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Conn es una conexión de un cliente en tiempo real. El Hub no depende del transporte:
+// el gateway de Socket.IO adapta sus sockets a esta interfaz y en pruebas basta con una
+// implementación en memoria que guarde los eventos recibidos
+type Conn interface {
+	ID() string
+	Emit(event string, data any) error
+}
+
+// Hub lleva la cuenta de qué conexiones están en cada sala y reparte los eventos entre ellas
+type Hub struct {
+	mu    sync.RWMutex
+	rooms map[string]map[string]Conn
+	conns map[string]map[string]bool
+}
+
+// NewHub crea un Hub vacío
+func NewHub() *Hub {
+	return &Hub{
+		rooms: make(map[string]map[string]Conn),
+		conns: make(map[string]map[string]bool),
+	}
+}
+
+// UserRoom es la sala privada de un usuario; todas sus conexiones entran en ella al conectarse
+func UserRoom(email string) string {
+	return "user:" + email
+}
+
+// NovelRoom es la sala de los lectores que siguen en directo una novela
+func NovelRoom(novelID uint) string {
+	return "novel:" + strconv.FormatUint(uint64(novelID), 10)
+}
+
+// Join añade la conexión a las salas indicadas
+func (h *Hub) Join(conn Conn, rooms ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	joined, found := h.conns[conn.ID()]
+	if !found {
+		joined = make(map[string]bool)
+		h.conns[conn.ID()] = joined
+	}
+	for _, room := range rooms {
+		members, found := h.rooms[room]
+		if !found {
+			members = make(map[string]Conn)
+			h.rooms[room] = members
+		}
+		members[conn.ID()] = conn
+		joined[room] = true
+	}
+}
+
+// Leave saca la conexión de una sala
+func (h *Hub) Leave(conn Conn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.leave(conn.ID(), room)
+	if len(h.conns[conn.ID()]) == 0 {
+		delete(h.conns, conn.ID())
+	}
+}
+
+// Disconnect saca la conexión de todas sus salas
+func (h *Hub) Disconnect(conn Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for room := range h.conns[conn.ID()] {
+		h.leave(conn.ID(), room)
+	}
+	delete(h.conns, conn.ID())
+}
+
+// leave elimina la conexión de la sala y la sala si queda vacía. Se llama con el lock tomado
+func (h *Hub) leave(connID, room string) {
+	if members, found := h.rooms[room]; found {
+		delete(members, connID)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+	delete(h.conns[connID], room)
+}
+
+// Rooms devuelve las salas en las que está la conexión
+func (h *Hub) Rooms(conn Conn) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rooms := make([]string, 0, len(h.conns[conn.ID()]))
+	for room := range h.conns[conn.ID()] {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Size devuelve el número de conexiones de una sala
+func (h *Hub) Size(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
+
+// Emit envía el evento a todas las conexiones de la sala y devuelve a cuántas se entregó.
+// Los envíos se hacen fuera del lock para que un cliente lento no bloquee las salas
+func (h *Hub) Emit(room, event string, data any) int {
+	h.mu.RLock()
+	members := make([]Conn, 0, len(h.rooms[room]))
+	for _, conn := range h.rooms[room] {
+		members = append(members, conn)
+	}
+	h.mu.RUnlock()
+
+	delivered := 0
+	for _, conn := range members {
+		if err := conn.Emit(event, data); err != nil {
+			fmt.Printf("Error al enviar %s a la conexión %s: %v\n", event, conn.ID(), err)
+			continue
+		}
+		delivered++
+	}
+	return delivered
+}
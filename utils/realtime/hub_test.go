@@ -0,0 +1,106 @@
+package realtime
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// memConn es una conexión en memoria que guarda los eventos recibidos
+type memConn struct {
+	id     string
+	fail   bool
+	mu     sync.Mutex
+	events []string
+}
+
+func (c *memConn) ID() string { return c.id }
+
+func (c *memConn) Emit(event string, data any) error {
+	if c.fail {
+		return errors.New("conexión cerrada")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+	return nil
+}
+
+func (c *memConn) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.events)
+}
+
+func TestJoinAndLeaveRooms(t *testing.T) {
+	hub := NewHub()
+	conn := &memConn{id: "a"}
+
+	hub.Join(conn, UserRoom("ana@example.com"), NovelRoom(7))
+	if hub.Size(NovelRoom(7)) != 1 {
+		t.Fatalf("Size(novel:7) = %d, se esperaba 1", hub.Size(NovelRoom(7)))
+	}
+	rooms := hub.Rooms(conn)
+	slices.Sort(rooms)
+	if !slices.Equal(rooms, []string{"novel:7", "user:ana@example.com"}) {
+		t.Fatalf("Rooms = %v", rooms)
+	}
+
+	hub.Leave(conn, NovelRoom(7))
+	if hub.Size(NovelRoom(7)) != 0 {
+		t.Errorf("la conexión sigue en novel:7 tras Leave")
+	}
+	if n := hub.PublishChapter(7, "capítulo"); n != 0 {
+		t.Errorf("PublishChapter tras Leave entregó %d eventos", n)
+	}
+	if rooms := hub.Rooms(conn); !slices.Equal(rooms, []string{"user:ana@example.com"}) {
+		t.Errorf("Rooms tras Leave = %v", rooms)
+	}
+
+	hub.Disconnect(conn)
+	if hub.Size(UserRoom("ana@example.com")) != 0 || len(hub.Rooms(conn)) != 0 {
+		t.Errorf("la conexión sigue en alguna sala tras Disconnect")
+	}
+}
+
+func TestDeliveryPerUser(t *testing.T) {
+	hub := NewHub()
+	phone := &memConn{id: "ana-movil"}
+	laptop := &memConn{id: "ana-portatil"}
+	other := &memConn{id: "luis"}
+	hub.Join(phone, UserRoom("ana@example.com"))
+	hub.Join(laptop, UserRoom("ana@example.com"))
+	hub.Join(other, UserRoom("luis@example.com"))
+
+	if n := hub.NotifyUser("ana@example.com", "hola"); n != 2 {
+		t.Errorf("NotifyUser entregó %d eventos, se esperaban 2", n)
+	}
+	if n := hub.PublishCommentReply("luis@example.com", "respuesta"); n != 1 {
+		t.Errorf("PublishCommentReply entregó %d eventos, se esperaba 1", n)
+	}
+
+	for _, conn := range []*memConn{phone, laptop} {
+		if got := conn.received(); !slices.Equal(got, []string{EventNotification}) {
+			t.Errorf("%s recibió %v", conn.id, got)
+		}
+	}
+	if got := other.received(); !slices.Equal(got, []string{EventCommentReply}) {
+		t.Errorf("luis recibió %v", got)
+	}
+}
+
+func TestEmitSkipsFailedConnections(t *testing.T) {
+	hub := NewHub()
+	ok := &memConn{id: "ok"}
+	closed := &memConn{id: "cerrada", fail: true}
+	hub.Join(ok, NovelRoom(1))
+	hub.Join(closed, NovelRoom(1))
+
+	if n := hub.PublishChapter(1, "capítulo"); n != 1 {
+		t.Errorf("PublishChapter entregó %d eventos, se esperaba 1", n)
+	}
+	if got := ok.received(); !slices.Equal(got, []string{EventChapterNew}) {
+		t.Errorf("ok recibió %v", got)
+	}
+}
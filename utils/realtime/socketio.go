@@ -0,0 +1,201 @@
+package realtime
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zishang520/socket.io/v2/socket"
+)
+
+// revalidateInterval es cada cuánto se comprueba que las sesiones de los sockets conectados
+// siguen abiertas. Un logout o una revocación cierra el socket como mucho en este tiempo
+const revalidateInterval = 30 * time.Second
+
+// maxNovelRooms limita las novelas que una conexión puede seguir a la vez
+const maxNovelRooms = 100
+
+// Session es el resultado de autenticar el handshake de un cliente
+type Session struct {
+	Email string
+	// Active indica si la sesión sigue siendo válida y la cuenta activa. Si es nil no se revalida
+	Active func() bool
+}
+
+// Authenticator valida los datos de auth del handshake de Socket.IO
+type Authenticator func(auth map[string]interface{}) (*Session, error)
+
+// Gateway expone el Hub a los clientes mediante Socket.IO. Cada socket autenticado entra en la
+// sala de su usuario y puede suscribirse a novelas con los eventos novel:subscribe y novel:unsubscribe
+type Gateway struct {
+	hub          *Hub
+	io           *socket.Server
+	authenticate Authenticator
+
+	mu      sync.Mutex
+	clients map[string]*socketConn
+	stop    chan struct{}
+}
+
+// socketConn adapta un socket de Socket.IO a la interfaz Conn
+type socketConn struct {
+	socket  *socket.Socket
+	session *Session
+}
+
+func (c *socketConn) ID() string {
+	return string(c.socket.Id())
+}
+
+func (c *socketConn) Emit(event string, data any) error {
+	return c.socket.Emit(event, data)
+}
+
+// NewGateway crea el servidor de Socket.IO y arranca la revalidación periódica de sesiones
+func NewGateway(hub *Hub, authenticate Authenticator) *Gateway {
+	g := &Gateway{
+		hub:          hub,
+		io:           socket.NewServer(nil, nil),
+		authenticate: authenticate,
+		clients:      make(map[string]*socketConn),
+		stop:         make(chan struct{}),
+	}
+
+	g.io.Use(g.authMiddleware)
+	g.io.On("connection", func(args ...any) {
+		g.onConnection(args[0].(*socket.Socket))
+	})
+
+	go g.revalidate()
+	return g
+}
+
+// Handler devuelve el http.Handler que se monta en /socket.io/
+func (g *Gateway) Handler() http.Handler {
+	return g.io.ServeHandler(nil)
+}
+
+// Close desconecta a todos los clientes y detiene la revalidación
+func (g *Gateway) Close() {
+	close(g.stop)
+	g.io.Close(nil)
+}
+
+// authMiddleware rechaza el handshake si el cliente no envía un token de acceso válido
+func (g *Gateway) authMiddleware(s *socket.Socket, next func(*socket.ExtendedError)) {
+	authData, _ := s.Handshake().Auth.(map[string]interface{})
+	if authData == nil {
+		next(socket.NewExtendedError("No autorizado", nil))
+		return
+	}
+
+	session, err := g.authenticate(authData)
+	if err != nil {
+		next(socket.NewExtendedError("No autorizado", err.Error()))
+		return
+	}
+
+	s.SetData(session)
+	next(nil)
+}
+
+func (g *Gateway) onConnection(s *socket.Socket) {
+	session, ok := s.Data().(*Session)
+	if !ok {
+		s.Disconnect(true)
+		return
+	}
+	conn := &socketConn{socket: s, session: session}
+
+	g.mu.Lock()
+	g.clients[conn.ID()] = conn
+	g.mu.Unlock()
+	g.hub.Join(conn, UserRoom(session.Email))
+
+	s.On(EventNovelSubscribe, func(args ...any) {
+		novelID, ok := novelIDArg(args)
+		if !ok {
+			reply(args, map[string]any{"error": "Identificador de novela inválido"})
+			return
+		}
+		if len(g.hub.Rooms(conn)) > maxNovelRooms {
+			reply(args, map[string]any{"error": "Has alcanzado el número máximo de novelas seguidas en directo"})
+			return
+		}
+		g.hub.Join(conn, NovelRoom(novelID))
+		reply(args, map[string]any{"ok": true, "room": NovelRoom(novelID)})
+	})
+
+	s.On(EventNovelUnsubscribe, func(args ...any) {
+		novelID, ok := novelIDArg(args)
+		if !ok {
+			reply(args, map[string]any{"error": "Identificador de novela inválido"})
+			return
+		}
+		g.hub.Leave(conn, NovelRoom(novelID))
+		reply(args, map[string]any{"ok": true})
+	})
+
+	s.On("disconnect", func(...any) {
+		g.hub.Disconnect(conn)
+		g.mu.Lock()
+		delete(g.clients, conn.ID())
+		g.mu.Unlock()
+	})
+}
+
+// revalidate cierra los sockets cuya sesión se ha revocado o cuya cuenta ya no está activa
+func (g *Gateway) revalidate() {
+	ticker := time.NewTicker(revalidateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+
+		g.mu.Lock()
+		conns := make([]*socketConn, 0, len(g.clients))
+		for _, conn := range g.clients {
+			conns = append(conns, conn)
+		}
+		g.mu.Unlock()
+
+		for _, conn := range conns {
+			if conn.session.Active != nil && !conn.session.Active() {
+				conn.socket.Disconnect(true)
+			}
+		}
+	}
+}
+
+// novelIDArg lee el id de novela del primer argumento del evento (número o cadena)
+func novelIDArg(args []any) (uint, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	switch value := args[0].(type) {
+	case float64:
+		if value >= 1 && value == float64(uint(value)) {
+			return uint(value), true
+		}
+	case string:
+		if id, err := strconv.ParseUint(value, 10, 32); err == nil && id > 0 {
+			return uint(id), true
+		}
+	}
+	return 0, false
+}
+
+// reply responde al ack del cliente si lo ha pedido (el callback llega como último argumento)
+func reply(args []any, response any) {
+	if len(args) == 0 {
+		return
+	}
+	if ack, ok := args[len(args)-1].(socket.Ack); ok {
+		ack([]any{response}, nil)
+	}
+}
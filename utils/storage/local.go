@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// LocalStorage guarda los archivos en el disco, en Dir. El servidor los publica en la ruta de
+// PublicURL (ver Route); pensado para desarrollo local y despliegues con un solo servidor
+type LocalStorage struct {
+	Dir       string
+	PublicURL string
+}
+
+// Route devuelve la ruta HTTP desde la que hay que servir Dir, p. ej. "/uploads"
+func (s *LocalStorage) Route() string {
+	if parsed, err := url.Parse(s.PublicURL); err == nil && parsed.Path != "" {
+		return parsed.Path
+	}
+	return "/uploads"
+}
+
+// Put implementa Storage. El archivo se escribe con otro nombre y se renombra al terminar para
+// que nunca se sirva a medias
+func (s *LocalStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", fmt.Errorf("error al crear el directorio: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("error al crear el archivo: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("error al escribir el archivo: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("error al escribir el archivo: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", fmt.Errorf("error al guardar el archivo: %v", err)
+	}
+
+	return s.PublicURL + "/" + key, nil
+}
+
+// Get implementa Storage
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Delete implementa Storage
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NextcloudStorage sube los archivos por WebDAV a la cuenta Username y los publica con un enlace
+// compartido de la API OCS. Las claves son rutas dentro de la carpeta de archivos de esa cuenta
+type NextcloudStorage struct {
+	BaseURL  string
+	Username string
+	Password string
+	// Client es opcional; por defecto se usa un cliente con un timeout de 30 segundos
+	Client *http.Client
+}
+
+func (s *NextcloudStorage) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return defaultClient
+}
+
+// davURL devuelve la URL WebDAV de una ruta de la cuenta, con cada segmento escapado
+func (s *NextcloudStorage) davURL(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s/remote.php/dav/files/%s/%s", s.BaseURL, url.PathEscape(s.Username), strings.Join(segments, "/"))
+}
+
+func (s *NextcloudStorage) do(ctx context.Context, method, target string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.SetBasicAuth(s.Username, s.Password)
+	return s.client().Do(req)
+}
+
+// mkdirAll crea las carpetas de la clave que no existan. MKCOL responde 405 si ya existe
+func (s *NextcloudStorage) mkdirAll(ctx context.Context, key string) error {
+	parts := strings.Split(key, "/")
+	for i := 1; i < len(parts); i++ {
+		resp, err := s.do(ctx, "MKCOL", s.davURL(strings.Join(parts[:i], "/")), nil, nil)
+		if err != nil {
+			return fmt.Errorf("error de conexión con Nextcloud: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("error al crear la carpeta en Nextcloud: %s", resp.Status)
+		}
+	}
+	return nil
+}
+
+// Put implementa Storage
+func (s *NextcloudStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if err := s.mkdirAll(ctx, key); err != nil {
+		return "", err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	resp, err := s.do(ctx, http.MethodPut, s.davURL(key), body, header)
+	if err != nil {
+		return "", fmt.Errorf("error de conexión con Nextcloud: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error al subir el archivo a Nextcloud: %s", resp.Status)
+	}
+
+	publicURL, err := s.share(ctx, key)
+	if err != nil {
+		// Sin enlace público el archivo no sirve de nada
+		s.Delete(ctx, key)
+		return "", err
+	}
+	return publicURL, nil
+}
+
+// ocsShareResponse es la respuesta JSON de la API de compartición de Nextcloud
+type ocsShareResponse struct {
+	OCS struct {
+		Meta struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"meta"`
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	} `json:"ocs"`
+}
+
+// share crea un enlace público de solo lectura y devuelve la URL de descarga directa del archivo
+func (s *NextcloudStorage) share(ctx context.Context, key string) (string, error) {
+	form := url.Values{}
+	form.Set("path", "/"+key)
+	form.Set("shareType", "3") // enlace público
+	form.Set("permissions", "1")
+
+	header := http.Header{}
+	header.Set("OCS-APIRequest", "true")
+	header.Set("Accept", "application/json")
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.do(ctx, http.MethodPost, s.BaseURL+"/ocs/v2.php/apps/files_sharing/api/v1/shares?format=json",
+		strings.NewReader(form.Encode()), header)
+	if err != nil {
+		return "", fmt.Errorf("error de conexión con Nextcloud: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result ocsShareResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return "", fmt.Errorf("respuesta inesperada de Nextcloud al compartir (%s)", resp.Status)
+	}
+	if result.OCS.Meta.Status != "ok" || result.OCS.Data.URL == "" {
+		return "", fmt.Errorf("error en Nextcloud al compartir: %s", result.OCS.Meta.Message)
+	}
+	// La URL del enlace abre una página de Nextcloud; /download sirve el archivo en sí
+	return strings.TrimRight(result.OCS.Data.URL, "/") + "/download", nil
+}
+
+// Get implementa Storage
+func (s *NextcloudStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.davURL(key), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error de conexión con Nextcloud: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error al leer el archivo de Nextcloud: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Delete implementa Storage. Al borrar el archivo Nextcloud elimina también sus enlaces
+func (s *NextcloudStorage) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.davURL(key), nil, nil)
+	if err != nil {
+		return fmt.Errorf("error de conexión con Nextcloud: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("error al borrar el archivo de Nextcloud: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeNextcloud simula el WebDAV y la API de compartición de una cuenta de Nextcloud
+type fakeNextcloud struct {
+	mu      sync.Mutex
+	dirs    map[string]bool
+	files   map[string]string
+	shares  int
+	noShare bool
+}
+
+func newFakeNextcloud(t *testing.T) (*fakeNextcloud, *NextcloudStorage) {
+	fake := &fakeNextcloud{dirs: map[string]bool{}, files: map[string]string{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, &NextcloudStorage{BaseURL: server.URL, Username: "bot", Password: "secreto", Client: server.Client()}
+}
+
+func (f *fakeNextcloud) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if user, pass, ok := r.BasicAuth(); !ok || user != "bot" || pass != "secreto" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/ocs/") {
+		if r.Header.Get("OCS-APIRequest") != "true" || r.FormValue("shareType") != "3" || f.files[r.FormValue("path")] == "" || f.noShare {
+			w.Write([]byte(`{"ocs":{"meta":{"status":"failure","message":"Wrong path"},"data":[]}}`))
+			return
+		}
+		f.shares++
+		w.Write([]byte(`{"ocs":{"meta":{"status":"ok","message":"OK"},"data":{"url":"https://nube.example/s/abc"}}}`))
+		return
+	}
+
+	const prefix = "/remote.php/dav/files/bot"
+	if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, prefix)
+	parent := name[:strings.LastIndex(name, "/")]
+
+	switch r.Method {
+	case "MKCOL":
+		if f.dirs[name] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		f.dirs[name] = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		if parent != "" && !f.dirs[parent] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.files[name] = string(body)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		body, ok := f.files[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	case http.MethodDelete:
+		if _, ok := f.files[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.files, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestNextcloudPutGetDelete(t *testing.T) {
+	fake, store := newFakeNextcloud(t)
+	ctx := context.Background()
+
+	url, err := store.Put(ctx, "avatars/a_64.webp", strings.NewReader("imagen"), 6, "image/webp")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if url != "https://nube.example/s/abc/download" {
+		t.Errorf("URL = %q", url)
+	}
+	// La carpeta ya existe: el segundo MKCOL responde 405 y no debe fallar
+	if _, err := store.Put(ctx, "avatars/a_128.webp", strings.NewReader("otra"), 4, "image/webp"); err != nil {
+		t.Fatalf("Put en carpeta existente: %v", err)
+	}
+	if fake.shares != 2 {
+		t.Errorf("enlaces creados = %d, se esperaban 2", fake.shares)
+	}
+
+	object, err := store.Get(ctx, "avatars/a_64.webp")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	body, _ := io.ReadAll(object)
+	object.Close()
+	if string(body) != "imagen" {
+		t.Errorf("contenido = %q", body)
+	}
+
+	if err := store.Delete(ctx, "avatars/a_64.webp"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, "avatars/a_64.webp"); err != nil {
+		t.Fatalf("Delete de un archivo que ya no existe: %v", err)
+	}
+	if _, err := store.Get(ctx, "avatars/a_64.webp"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get tras Delete = %v, se esperaba ErrNotFound", err)
+	}
+}
+
+func TestNextcloudShareFailureRemovesFile(t *testing.T) {
+	fake, store := newFakeNextcloud(t)
+	fake.noShare = true
+
+	if _, err := store.Put(context.Background(), "avatars/a_64.jpg", strings.NewReader("imagen"), 6, "image/jpeg"); err == nil {
+		t.Fatal("Put debería fallar si no se puede compartir")
+	}
+	if len(fake.files) != 0 {
+		t.Errorf("quedan archivos sin enlace público: %v", fake.files)
+	}
+}
+
+func TestNextcloudRejectsInvalidKeys(t *testing.T) {
+	_, store := newFakeNextcloud(t)
+	for _, key := range []string{"", "/avatars/a.jpg", "../a.jpg", "avatars/../../a.jpg"} {
+		if _, err := store.Put(context.Background(), key, strings.NewReader("x"), 1, "image/jpeg"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, se esperaba ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Storage guarda los archivos en un bucket compatible con S3 (AWS, MinIO, R2...) firmando las
+// peticiones con AWS Signature Version 4. El bucket debe permitir la lectura pública de los
+// objetos, o PublicURL apuntar a una CDN que los sirva
+type S3Storage struct {
+	Endpoint  string // p. ej. https://s3.eu-west-1.amazonaws.com o http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle usa endpoint/bucket/clave en lugar de bucket.endpoint/clave (necesario en MinIO)
+	PathStyle bool
+	// PublicURL es opcional; por defecto las URLs públicas son las del propio endpoint
+	PublicURL string
+	// Client es opcional; por defecto se usa un cliente con un timeout de 30 segundos
+	Client *http.Client
+}
+
+func (s *S3Storage) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return defaultClient
+}
+
+// escapeKey escapa cada segmento de la clave como pide S3
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// objectURL devuelve la URL del objeto en el endpoint
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT no válido: %s", s.Endpoint)
+	}
+	if s.PathStyle {
+		endpoint.Path = strings.TrimRight(endpoint.Path, "/") + "/" + s.Bucket + "/" + key
+		endpoint.RawPath = strings.TrimRight(endpoint.EscapedPath(), "/") + "/" + url.PathEscape(s.Bucket) + "/" + escapeKey(key)
+	} else {
+		endpoint.Host = s.Bucket + "." + endpoint.Host
+		endpoint.Path = "/" + key
+		endpoint.RawPath = "/" + escapeKey(key)
+	}
+	return endpoint, nil
+}
+
+// publicURL devuelve la URL con la que se lee el objeto
+func (s *S3Storage) publicURL(key string) (string, error) {
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + escapeKey(key), nil
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Put implementa Storage. El contenido se lee entero para firmar su SHA-256
+func (s *S3Storage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	resp, err := s.send(ctx, http.MethodPut, key, data, header)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return s.publicURL(key)
+}
+
+// Get implementa Storage
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.send(ctx, http.MethodGet, key, nil, http.Header{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete implementa Storage. S3 responde 204 también si la clave no existía
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.send(ctx, http.MethodDelete, key, nil, http.Header{})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// send firma y envía la petición. Las respuestas de error se convierten en error (ErrNotFound si
+// es un 404); si no, el llamante debe cerrar el cuerpo de la respuesta
+func (s *S3Storage) send(ctx context.Context, method, key string, data []byte, header http.Header) (*http.Response, error) {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(data))
+
+	s.sign(req, data, time.Now().UTC())
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error de conexión con S3: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("error de S3 (%s): %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return resp, nil
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign añade a la petición las cabeceras x-amz-date, x-amz-content-sha256 y Authorization de
+// AWS Signature Version 4. Se firman Host y todas las cabeceras x-amz-*, Content-Type y Range
+func (s *S3Storage) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signed := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "range" {
+			signed[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
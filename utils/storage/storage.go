@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Storage guarda archivos públicos (avatares, portadas...) en un almacenamiento de objetos. Las
+// claves son rutas relativas con "/" como separador, p. ej. "avatars/1f0c_64.webp"
+type Storage interface {
+	// Put guarda el contenido con la clave indicada, sustituyendo el que hubiera, y devuelve su URL pública
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error)
+	// Get abre el objeto para leerlo. Devuelve ErrNotFound si no existe
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete borra el objeto. Borrar una clave que no existe no es un error
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	// ErrInvalidKey se devuelve con claves vacías, absolutas o que salen de la raíz con ".."
+	ErrInvalidKey = errors.New("clave de almacenamiento no válida")
+	// ErrNotFound se devuelve al leer una clave que no existe
+	ErrNotFound = errors.New("el archivo no existe")
+)
+
+// cleanKey valida la clave y la devuelve normalizada
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
+
+// defaultClient es el cliente HTTP de los almacenamientos remotos
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// FromEnv construye el almacenamiento configurado en STORAGE_DRIVER ("nextcloud", "local" o "s3").
+// Sin STORAGE_DRIVER se usa Nextcloud si NEXTCLOUD_BASE_URL está definido y el disco local si no
+func FromEnv() (Storage, error) {
+	driver := strings.ToLower(os.Getenv("STORAGE_DRIVER"))
+	if driver == "" {
+		driver = "local"
+		if os.Getenv("NEXTCLOUD_BASE_URL") != "" {
+			driver = "nextcloud"
+		}
+	}
+
+	switch driver {
+	case "nextcloud":
+		s := &NextcloudStorage{
+			BaseURL:  strings.TrimRight(os.Getenv("NEXTCLOUD_BASE_URL"), "/"),
+			Username: os.Getenv("NEXTCLOUD_USERNAME"),
+			Password: os.Getenv("NEXTCLOUD_PASSWORD"),
+		}
+		if s.BaseURL == "" || s.Username == "" || s.Password == "" {
+			return nil, fmt.Errorf("NEXTCLOUD_BASE_URL, NEXTCLOUD_USERNAME y NEXTCLOUD_PASSWORD son obligatorios con STORAGE_DRIVER=nextcloud")
+		}
+		return s, nil
+	case "local":
+		s := &LocalStorage{
+			Dir:       os.Getenv("STORAGE_LOCAL_DIR"),
+			PublicURL: strings.TrimRight(os.Getenv("STORAGE_PUBLIC_URL"), "/"),
+		}
+		if s.Dir == "" {
+			s.Dir = "uploads"
+		}
+		if s.PublicURL == "" {
+			s.PublicURL = "/uploads"
+		}
+		return s, nil
+	case "s3":
+		s := &S3Storage{
+			Endpoint:  strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+			PublicURL: strings.TrimRight(os.Getenv("S3_PUBLIC_URL"), "/"),
+		}
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID y S3_SECRET_ACCESS_KEY son obligatorios con STORAGE_DRIVER=s3")
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("STORAGE_DRIVER desconocido: %s", driver)
+	}
+}
@@ -0,0 +1,97 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret es la clave ASCII "12345678901234567890" de los vectores de las RFC 4226 y 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPMatchesRFC4226(t *testing.T) {
+	// Apéndice D de la RFC 4226
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	key := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := hotp(key, int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, se esperaba %s", counter, got, code)
+		}
+	}
+}
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	// Apéndice B de la RFC 6238 (SHA-1), truncados a los 6 dígitos que usamos
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		at := time.Unix(unix, 0)
+		got, err := Code(rfcSecret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Code(%d) = %s, se esperaba %s", unix, got, want)
+		}
+		if counter, ok := Validate(rfcSecret, want, at); !ok || counter != Counter(at) {
+			t.Errorf("Validate(%d) = %d, %v", unix, counter, ok)
+		}
+	}
+}
+
+func TestValidateAcceptsOnePeriodOfSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, offset := range []time.Duration{-Period * time.Second, Period * time.Second} {
+		if counter, ok := Validate(rfcSecret, code, now.Add(offset)); !ok || counter != Counter(now) {
+			t.Errorf("con un desfase de %v: %d, %v", offset, counter, ok)
+		}
+	}
+	for _, offset := range []time.Duration{-2 * Period * time.Second, 2 * Period * time.Second} {
+		if _, ok := Validate(rfcSecret, code, now.Add(offset)); ok {
+			t.Errorf("se aceptó el código con un desfase de %v", offset)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := Code(rfcSecret, now)
+
+	if _, ok := Validate(rfcSecret, " "+code[:3]+" "+code[3:]+" ", now); !ok {
+		t.Error("no se aceptó el código con espacios")
+	}
+	for _, bad := range []string{"", "12345", code + "0", "14050471", "abcdef", strings.Repeat("0", 1000)} {
+		if _, ok := Validate(rfcSecret, bad, now); ok {
+			t.Errorf("se aceptó el código %q", bad)
+		}
+	}
+	if _, ok := Validate("no es base32!", code, now); ok {
+		t.Error("se aceptó un secreto inválido")
+	}
+}
+
+func TestGenerateSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(strings.ToLower(secret), code, now); !ok {
+		t.Error("no se validó un código del secreto generado")
+	}
+}
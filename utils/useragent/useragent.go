@@ -0,0 +1,165 @@
+// Package useragent extrae de forma aproximada el navegador, el sistema operativo y el tipo de
+// dispositivo de una cabecera User-Agent, para mostrar las sesiones abiertas al usuario
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Tipos de dispositivo
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// Info es el resultado de analizar un User-Agent
+type Info struct {
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os"`
+	Device         string `json:"device"`
+}
+
+// browserRule asocia el token de un navegador con su nombre. El orden importa: muchos
+// navegadores incluyen también "Chrome/" y "Safari/" en su User-Agent
+type browserRule struct {
+	token string
+	name  string
+}
+
+var browserRules = []browserRule{
+	{"EdgiOS/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex"},
+	{"Vivaldi/", "Vivaldi"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+}
+
+var (
+	versionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?`)
+	windowsPattern = regexp.MustCompile(`Windows NT ([0-9.]+)`)
+	androidPattern = regexp.MustCompile(`Android ([0-9.]+)`)
+	iosPattern     = regexp.MustCompile(`OS ([0-9_]+) like Mac OS X`)
+	macPattern     = regexp.MustCompile(`Mac OS X ([0-9_.]+)`)
+	botPattern     = regexp.MustCompile(`(?i)bot|crawler|spider|slurp|curl|wget|python-requests|httpclient`)
+)
+
+// windowsVersions traduce la versión de NT a la comercial
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+}
+
+// versionAfter devuelve la versión mayor.menor que sigue al token
+func versionAfter(ua, token string) string {
+	idx := strings.Index(ua, token)
+	if idx < 0 {
+		return ""
+	}
+	return versionPattern.FindString(ua[idx+len(token):])
+}
+
+// Parse analiza una cabecera User-Agent
+func Parse(ua string) Info {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return Info{Browser: "Desconocido", OS: "Desconocido", Device: DeviceUnknown}
+	}
+
+	info := Info{
+		Browser: parseBrowser(ua),
+		OS:      parseOS(ua),
+		Device:  parseDevice(ua),
+	}
+	for _, rule := range browserRules {
+		if rule.name == info.Browser && strings.Contains(ua, rule.token) {
+			info.BrowserVersion = versionAfter(ua, rule.token)
+			break
+		}
+	}
+	if info.Browser == "Safari" {
+		info.BrowserVersion = versionAfter(ua, "Version/")
+	}
+	return info
+}
+
+func parseBrowser(ua string) string {
+	for _, rule := range browserRules {
+		if strings.Contains(ua, rule.token) {
+			return rule.name
+		}
+	}
+	if strings.Contains(ua, "Safari/") && strings.Contains(ua, "Version/") {
+		return "Safari"
+	}
+	if strings.Contains(ua, "Trident/") || strings.Contains(ua, "MSIE ") {
+		return "Internet Explorer"
+	}
+	// Clientes que no son navegadores (apps, curl, Postman...): se usa el primer producto
+	product, _, _ := strings.Cut(ua, " ")
+	name, _, _ := strings.Cut(product, "/")
+	if name == "" || name == "Mozilla" {
+		return "Desconocido"
+	}
+	return name
+}
+
+func parseOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		if m := iosPattern.FindStringSubmatch(ua); m != nil {
+			return "iOS " + strings.ReplaceAll(m[1], "_", ".")
+		}
+		return "iOS"
+	case strings.Contains(ua, "Android"):
+		if m := androidPattern.FindStringSubmatch(ua); m != nil {
+			return "Android " + m[1]
+		}
+		return "Android"
+	case strings.Contains(ua, "Windows"):
+		if m := windowsPattern.FindStringSubmatch(ua); m != nil {
+			if name, ok := windowsVersions[m[1]]; ok {
+				return "Windows " + name
+			}
+		}
+		return "Windows"
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(ua, "Mac OS X"):
+		if m := macPattern.FindStringSubmatch(ua); m != nil {
+			return "macOS " + strings.ReplaceAll(m[1], "_", ".")
+		}
+		return "macOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	}
+	return "Desconocido"
+}
+
+func parseDevice(ua string) string {
+	switch {
+	case botPattern.MatchString(ua):
+		return DeviceBot
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		return DeviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		return DeviceMobile
+	case strings.Contains(ua, "Windows") || strings.Contains(ua, "Macintosh") ||
+		strings.Contains(ua, "X11") || strings.Contains(ua, "CrOS"):
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}